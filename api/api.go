@@ -2,28 +2,53 @@ package api
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func New(db *mongo.Client) *Api {
+func New(s store.Store) *Api {
 	return &Api{
-		Mongo:            db,
-		groupsColl:       db.Database("triplan").Collection("groups"),
-		usersColl:        db.Database("triplan").Collection("users"),
-		transactionsColl: db.Database("triplan").Collection("transactions"),
+		Store:        s,
+		users:        s.Users(),
+		groups:       s.Groups(),
+		transactions: s.Transactions(),
+		stats:        s.Stats(),
+		sessions:     s.Sessions(),
+		invitations:  s.Invitations(),
+		history:      s.History(),
+		idempotency:  s.IdempotentRequests(),
+		recurring:    s.RecurringTransactions(),
+		webhooks:     s.Webhooks(),
+		deliveries:   s.WebhookDeliveries(),
+		events:       newEventBus(),
+		// the scheduler only needs to know that there is something to deliver
+		webhookWake:   make(chan struct{}, 1),
+		webhookClient: newWebhookClient(false),
 	}
 }
 
 type Api struct {
-	Mongo            *mongo.Client
-	groupsColl       *mongo.Collection
-	usersColl        *mongo.Collection
-	transactionsColl *mongo.Collection
+	Store        store.Store
+	users        store.UserStore
+	groups       store.GroupStore
+	transactions store.TransactionStore
+	stats        store.StatsStore
+	sessions     store.SessionStore
+	invitations  store.InvitationStore
+	history      store.HistoryStore
+	idempotency  store.IdempotentRequestStore
+	recurring    store.RecurringTransactionStore
+	webhooks     store.WebhookStore
+	deliveries   store.WebhookDeliveryStore
+	events       *eventBus
+	// webhookWake wakes RunWebhookDeliveries up when deliveries are queued
+	webhookWake   chan struct{}
+	webhookClient *http.Client
+	// allowPrivateWebhooks is set by AllowPrivateWebhooks
+	allowPrivateWebhooks bool
 }
 
 func getId(idstring string) (primitive.ObjectID, error) {
@@ -37,19 +62,21 @@ func getId(idstring string) (primitive.ObjectID, error) {
 	return userId, err
 }
 
-func (api *Api) HomeStats(c *fiber.Ctx) error {
-	res := api.Mongo.Database("stats").Collection("http_calls").FindOneAndUpdate(c.Context(), bson.M{"_id": "/"}, bson.M{"$inc": bson.M{"count": 1}}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
-
-	if res.Err() != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "😢 could not do it: "+res.Err().Error())
+// notFound turns a store.ErrNotFound into a 404 naming the missing entity
+func notFound(err error, entity string) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, entity+" not found")
 	}
-	out := map[string]any{}
-	err := res.Decode(&out)
+	return err
+}
+
+func (api *Api) HomeStats(c *fiber.Ctx) error {
+	count, err := api.stats.IncrementCalls(c.Context(), "/")
 	if err != nil {
-		return err
+		return fiber.NewError(fiber.StatusBadRequest, "😢 could not do it: "+err.Error())
 	}
 	return c.JSON(fiber.Map{
 		"message": "Wow, triplan !",
-		"calls":   out["count"],
+		"calls":   count,
 	})
 }
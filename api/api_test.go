@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testApp serves the routes used by the tests from an in-memory store
+type testApp struct {
+	t   *testing.T
+	api *Api
+	app *fiber.App
+}
+
+func newTestApp(t *testing.T) *testApp {
+	api := New(store.NewMemory())
+	// the same error handler as main
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
+			code := fiber.StatusInternalServerError
+			var e *fiber.Error
+			if errors.As(err, &e) {
+				code = e.Code
+			}
+			return ctx.Status(code).JSON(fiber.Map{"error": err.Error()})
+		},
+	})
+
+	app.Post("/auth/signup", api.Signup)
+	app.Get("/auth/me", api.Authenticate, api.GetMe)
+	users := app.Group("/users", api.Authenticate)
+	users.Get("", api.GetUsers)
+	users.Get("/:id", api.GetUserInfo)
+	users.Post("", api.PostUser)
+	users.Patch("/:id", api.PatchUser)
+	users.Delete("/:id", api.DeleteUser)
+	groups := app.Group("/groups", api.Authenticate)
+	groups.Post("", api.PostGroup)
+	groups.Post("/restore", api.RestoreGroupBackup)
+	groups.Post("/join/:token", api.JoinGroup)
+	groups.Delete("/:id", api.DeleteGroup)
+	groups.Post("/:id/restore", api.RestoreGroup)
+	groups.Get("/:id/backup", api.GetGroupBackup)
+	groups.Get("/:id/users", api.GetUsersFromGroup)
+	groups.Patch("/:id", api.PatchGroup)
+	groups.Delete("/:id/members/:userId", api.DeleteGroupMember)
+	groups.Get("/:id/balances", api.GetGroupBalances)
+	groups.Get("/:id/settlements", api.GetGroupSettlements)
+	groups.Get("/:id/stats", api.GetGroupStats)
+	groups.Get("/:id/invitations", api.GetGroupInvitations)
+	groups.Post("/:id/invitations", api.PostGroupInvitation)
+	groups.Delete("/:id/invitations/:invitationId", api.DeleteGroupInvitation)
+	groups.Post("/:id/transactions", api.PostGroupTransaction)
+	groups.Post("/:id/webhooks", api.PostGroupWebhook)
+	webhooks := app.Group("/webhooks", api.Authenticate)
+	webhooks.Get("/:id/deliveries", api.GetWebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:deliveryId/replay", api.ReplayWebhookDelivery)
+	transactions := app.Group("/transactions", api.Authenticate)
+	transactions.Patch("/:id", api.PatchTransaction)
+	transactions.Delete("/:id", api.DeleteTransaction)
+	transactions.Post("/:id/restore", api.RestoreTransaction)
+
+	return &testApp{t: t, api: api, app: app}
+}
+
+// do sends a request with body as JSON and decodes the JSON response into out, unless out is nil.
+// It returns the status of the response.
+func (a *testApp) do(method string, path string, token string, body any, out any, headers ...string) int {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	res, err := a.app.Test(req, -1)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	if out != nil && res.StatusCode < 300 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			a.t.Fatalf("%s %s: %v in %s", method, path, err, raw)
+		}
+	}
+	return res.StatusCode
+}
+
+// mustDo is do failing the test unless the response has the given status
+func (a *testApp) mustDo(status int, method string, path string, token string, body any, out any, headers ...string) {
+	a.t.Helper()
+	if got := a.do(method, path, token, body, out, headers...); got != status {
+		a.t.Fatalf("%s %s: status %d, want %d", method, path, got, status)
+	}
+}
+
+// signup creates an account and returns its session
+func (a *testApp) signup(name string) SessionResponse {
+	a.t.Helper()
+	var session SessionResponse
+	a.mustDo(fiber.StatusOK, "POST", "/auth/signup", "", Credentials{Name: name, Email: name + "@example.com", Password: "password"}, &session)
+	return session
+}
+
+func TestGroupBalances(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id}}, &group)
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, map[string]any{
+		"paidBy":   ann.User.Id,
+		"paidFor":  []map[string]any{{"user": ann.User.Id, "weight": 1}, {"user": bob.User.Id, "weight": 1}},
+		"amount":   1001,
+		"date":     "2024-01-01T00:00:00Z",
+		"category": "food",
+	}, nil)
+
+	var balances map[string]model.Balance
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/balances", bob.Token, nil, &balances)
+	if got := balances[ann.User.Id.Hex()].TotalAmount; got != 500 {
+		t.Errorf("balance of ann = %d, want 500", got)
+	}
+	if got := balances[bob.User.Id.Hex()].TotalAmount; got != -500 {
+		t.Errorf("balance of bob = %d, want -500", got)
+	}
+
+	var settlements []model.Settlement
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/settlements", bob.Token, nil, &settlements)
+	want := []model.Settlement{{From: bob.User.Id, To: ann.User.Id, Amount: 500}}
+	if len(settlements) != 1 || settlements[0] != want[0] {
+		t.Errorf("settlements = %v, want %v", settlements, want)
+	}
+
+	carol := a.signup("carol")
+	a.mustDo(fiber.StatusForbidden, "GET", "/groups/"+group.Id.Hex()+"/balances", carol.Token, nil, nil)
+}
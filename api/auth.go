@@ -0,0 +1,217 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// SessionDuration is how long a session token stays valid after login
+	SessionDuration   = 30 * 24 * time.Hour
+	minPasswordLength = 8
+	localsUser        = "user"
+	localsSession     = "session"
+)
+
+type Credentials struct {
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type SessionResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	User      model.User `json:"user"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// currentUser returns the user authenticated by the Authenticate middleware
+func currentUser(c *fiber.Ctx) model.User {
+	user, _ := c.Locals(localsUser).(model.User)
+	return user
+}
+
+// randomToken returns a new unguessable token
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// newSession creates a session for the user and sends its token to the client
+func (api *Api) newSession(c *fiber.Ctx, user model.User) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := model.Session{
+		User:      user.Id,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(SessionDuration),
+	}
+	err = api.sessions.Insert(c.Context(), &session)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(SessionResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      user,
+	})
+}
+
+// Authenticate is a middleware resolving the user from the "Authorization: Bearer <token>" header
+func (api *Api) Authenticate(c *fiber.Ctx) error {
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing bearer token")
+	}
+
+	session, err := api.sessions.Get(c.Context(), hashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+	}
+	if err != nil {
+		return err
+	}
+	if session.Expired(time.Now()) {
+		return fiber.NewError(fiber.StatusUnauthorized, "session expired")
+	}
+
+	user, err := api.users.Get(c.Context(), session.User)
+	if errors.Is(err, store.ErrNotFound) {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Locals(localsUser, user)
+	c.Locals(localsSession, session)
+	return c.Next()
+}
+
+// @Summary      Creates a user account and logs it in
+// @Accept       json
+// @Param        credentials  body      Credentials  true  "Name, e-mail and password of the account"
+// @Success      200  {object}  SessionResponse
+// @Router       /auth/signup [post]
+func (api *Api) Signup(c *fiber.Ctx) error {
+	var credentials Credentials
+	err := c.BodyParser(&credentials)
+	if err != nil {
+		return err
+	}
+	if credentials.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
+	}
+	email := normalizeEmail(credentials.Email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, `field "email" must be a valid e-mail address`)
+	}
+	if len(credentials.Password) < minPasswordLength {
+		return fiber.NewError(fiber.StatusBadRequest, `field "password" must be at least 8 characters long`)
+	}
+
+	_, err = api.users.GetByEmail(c.Context(), email)
+	if err == nil {
+		return fiber.NewError(fiber.StatusConflict, "an account already exists for this e-mail")
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user := model.User{
+		Name:         credentials.Name,
+		Email:        email,
+		PasswordHash: hash,
+	}
+	// the check above misses the concurrent signups, the store refuses the second one
+	err = api.users.Insert(c.Context(), &user)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return fiber.NewError(fiber.StatusConflict, "an account already exists for this e-mail")
+	}
+	if err != nil {
+		return err
+	}
+
+	return api.newSession(c, user)
+}
+
+// @Summary      Logs a user in
+// @Accept       json
+// @Param        credentials  body      Credentials  true  "E-mail and password of the account"
+// @Success      200  {object}  SessionResponse
+// @Router       /auth/login [post]
+func (api *Api) Login(c *fiber.Ctx) error {
+	var credentials Credentials
+	err := c.BodyParser(&credentials)
+	if err != nil {
+		return err
+	}
+
+	user, err := api.users.GetByEmail(c.Context(), normalizeEmail(credentials.Email))
+	if errors.Is(err, store.ErrNotFound) {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid e-mail or password")
+	}
+	if err != nil {
+		return err
+	}
+	if !user.HasAccount() || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(credentials.Password)) != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid e-mail or password")
+	}
+
+	return api.newSession(c, user)
+}
+
+// @Summary      Logs out the current session
+// @Success      204
+// @Router       /auth/logout [post]
+func (api *Api) Logout(c *fiber.Ctx) error {
+	session := c.Locals(localsSession).(model.Session)
+	err := api.sessions.Delete(c.Context(), session.Id)
+	if err != nil {
+		return err
+	}
+
+	c.Status(fiber.StatusNoContent)
+	return nil
+}
+
+// @Summary      Returns the logged in user
+// @Success      200  {object}  model.User
+// @Router       /auth/me [get]
+func (api *Api) GetMe(c *fiber.Ctx) error {
+	me := currentUser(c)
+	setETag(c, me.Version)
+	return c.JSON(me)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+func TestSignupEmailTaken(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+
+	a.mustDo(fiber.StatusConflict, "POST", "/auth/signup", "", Credentials{Name: "other ann", Email: ann.User.Email, Password: "password"}, nil)
+
+	// a signup racing the first one passes the check of the handler, the store must refuse it
+	err := a.api.users.Insert(context.Background(), &model.User{Name: "other ann", Email: ann.User.Email})
+	if !errors.Is(err, store.ErrAlreadyExists) {
+		t.Errorf("inserting a second user with the same email: %v, want %v", err, store.ErrAlreadyExists)
+	}
+	// users without an account have no email, there can be several of them
+	for i := 0; i < 2; i++ {
+		if err := a.api.users.Insert(context.Background(), &model.User{Name: "guest"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkRole checks that the current user has at least the given role in the group
+func checkRole(c *fiber.Ctx, group *model.Group, role model.Role) error {
+	userRole := group.RoleOf(currentUser(c).Id)
+	if userRole == "" {
+		return fiber.NewError(fiber.StatusForbidden, "you are not a member of this group")
+	}
+	if !userRole.AtLeast(role) {
+		return fiber.NewError(fiber.StatusForbidden, "this action requires the "+string(role)+" role in the group")
+	}
+	return nil
+}
+
+// groupWithRole loads a group that is not in the trash and checks that the current user has at least the given role in it
+func (api *Api) groupWithRole(c *fiber.Ctx, groupId primitive.ObjectID, role model.Role) (model.Group, error) {
+	group, err := api.groups.Get(c.Context(), groupId)
+	if err != nil {
+		return group, notFound(err, "group")
+	}
+	if group.DeletedAt != nil {
+		return group, notFound(store.ErrNotFound, "group")
+	}
+
+	return group, checkRole(c, &group, role)
+}
+
+// memberGroup loads a group the current user is a member of
+func (api *Api) memberGroup(c *fiber.Ctx, groupId primitive.ObjectID) (model.Group, error) {
+	return api.groupWithRole(c, groupId, model.RoleMember)
+}
+
+// memberTransaction loads a transaction that is not in the trash from a group the current user is a member of
+func (api *Api) memberTransaction(c *fiber.Ctx, transactionId primitive.ObjectID) (model.Transaction, model.Group, error) {
+	transaction, err := api.transactions.Get(c.Context(), transactionId)
+	if err != nil {
+		return transaction, model.Group{}, notFound(err, "transaction")
+	}
+	if transaction.DeletedAt != nil {
+		return transaction, model.Group{}, notFound(store.ErrNotFound, "transaction")
+	}
+	group, err := api.memberGroup(c, transaction.Group)
+	return transaction, group, err
+}
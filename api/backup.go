@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// @Summary      Returns an archive of a group with its transactions and users, to restore it later
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  model.GroupBackup
+// @Router       /groups/{id}/backup [get]
+func (api *Api) GetGroupBackup(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.groupWithRole(c, groupId, model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := api.transactions.List(c.Context(), store.TransactionFilter{
+		Group:    groupId,
+		Deletion: store.AnyDeletion,
+		Page:     store.Page{Sort: store.SortCreated},
+	})
+	if err != nil {
+		return err
+	}
+	backup := model.GroupBackup{
+		Version:      model.BackupVersion,
+		CreatedAt:    time.Now(),
+		Group:        group,
+		Transactions: transactions,
+	}
+	backup.Users, err = api.users.List(c.Context(), store.UserFilter{Ids: backup.UserIds()})
+	if err != nil {
+		return err
+	}
+	hideEmails(c, backup.Users)
+
+	c.Attachment(group.Id.Hex() + "-backup.json")
+	return c.JSON(backup)
+}
+
+// @Summary      Recreates a group and its transactions from an archive made by GET /groups/{id}/backup
+// @Description  Without freshIds, the group must no longer exist: it keeps its id, as its transactions do, and the current user
+// @Description  must have been an owner of it. With freshIds, the current user is the only owner of the copy.
+// @Description  Users that no longer exist are recreated without an account. Other users are only kept when they share a group
+// @Description  with the current user, the transactions of the users left out are left out too.
+// @Accept       json
+// @Param        freshIds  query     bool  false  "Give new ids to the group and its transactions, to restore a copy of a group that still exists"
+// @Param        backup  body      model.GroupBackup  true  "The archive"
+// @Success      200  {object}  model.Group
+// @Router       /groups/restore [post]
+func (api *Api) RestoreGroupBackup(c *fiber.Ctx) error {
+	var backup model.GroupBackup
+	err := c.BodyParser(&backup)
+	if err != nil {
+		return err
+	}
+	if err := backup.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	freshIds, err := queryBool(c, "freshIds")
+	if err != nil {
+		return err
+	}
+
+	// the archive is written by the client, only the database tells who may restore it and who may be in it
+	me := currentUser(c).Id
+	known, err := api.knownUsers(c.Context(), me)
+	if err != nil {
+		return err
+	}
+	if freshIds {
+		backup = backup.WithFreshIds()
+		backup.Group.Roles = []model.GroupRole{{User: me, Role: model.RoleOwner}}
+		if !backup.Group.HasMember(me) {
+			backup.Group.Users = append(backup.Group.Users, me)
+		}
+	} else {
+		archived, err := api.archivedGroup(c.Context(), backup.Group.Id)
+		if err != nil {
+			return err
+		}
+		if archived.RoleOf(me) != model.RoleOwner {
+			return fiber.NewError(fiber.StatusForbidden, "only the owners of the archived group can restore it, others can restore a copy of it with freshIds")
+		}
+		for _, userId := range append(archived.Users, archived.FormerUsers...) {
+			known[userId] = true
+		}
+	}
+	for _, user := range backup.Users {
+		if known[user.Id] {
+			continue
+		}
+		_, err := api.users.Get(c.Context(), user.Id)
+		if errors.Is(err, store.ErrNotFound) {
+			// recreated by the restore
+			known[user.Id] = true
+		} else if err != nil {
+			return err
+		}
+	}
+	backup = backup.WithUsers(func(userId primitive.ObjectID) bool {
+		return known[userId]
+	})
+
+	group := backup.Group
+	// the restored documents are new versions, older ETags must not match them
+	group.Version++
+	group.DeletedAt = nil
+	for i := range backup.Transactions {
+		transaction := &backup.Transactions[i]
+		transaction.Version++
+		transaction.Kind = transaction.GetKind()
+		// the recurring transactions are not part of the archive
+		transaction.Recurring = nil
+		if err := transaction.ComputePrices(); err != nil {
+			return fmt.Errorf(`%w: transaction "%s": %s`, fiber.ErrBadRequest, transaction.Id.Hex(), err.Error())
+		}
+	}
+
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		for i := range backup.Users {
+			if err := api.restoreUser(ctx, &backup.Users[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := api.validateGroup(ctx, &group); err != nil {
+			return err
+		}
+		err := api.groups.InsertWithId(ctx, &group)
+		if errors.Is(err, store.ErrAlreadyExists) {
+			return fiber.NewError(fiber.StatusConflict, "the group still exists, restore a copy of it with freshIds")
+		}
+		if err != nil {
+			return err
+		}
+		if err := api.recordBy(ctx, currentUser(c).Id, model.EntityGroup, group.Id, group.Id, model.ActionCreate, nil, &group); err != nil {
+			return err
+		}
+
+		for i := range backup.Transactions {
+			transaction := &backup.Transactions[i]
+			err := api.transactions.InsertWithId(ctx, transaction)
+			if errors.Is(err, store.ErrAlreadyExists) {
+				return fiber.NewError(fiber.StatusConflict, fmt.Sprintf(`transaction "%s" still exists, restore a copy of the group with freshIds`, transaction.Id.Hex()))
+			}
+			if err != nil {
+				return err
+			}
+			if err := api.recordBy(ctx, currentUser(c).Id, model.EntityTransaction, transaction.Id, group.Id, model.ActionCreate, nil, transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	setETag(c, group.Version)
+	return c.JSON(group)
+}
+
+// knownUsers returns the users sharing a group with the given user, including the groups in the trash and the users who left
+func (api *Api) knownUsers(ctx context.Context, userId primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	groups, err := api.groups.List(ctx, store.GroupFilter{User: userId, IncludeFormerUsers: true, Deletion: store.AnyDeletion})
+	if err != nil {
+		return nil, err
+	}
+	known := map[primitive.ObjectID]bool{userId: true}
+	for _, group := range groups {
+		for _, other := range append(group.Users, group.FormerUsers...) {
+			known[other] = true
+		}
+	}
+	return known, nil
+}
+
+// archivedGroup returns the group with the given id as it is stored, in the trash or not,
+// or as it was before being purged from the trash according to its history
+func (api *Api) archivedGroup(ctx context.Context, groupId primitive.ObjectID) (model.Group, error) {
+	group, err := api.groups.Get(ctx, groupId)
+	if !errors.Is(err, store.ErrNotFound) {
+		return group, err
+	}
+
+	entries, err := api.history.List(ctx, store.HistoryFilter{Group: groupId, EntityId: groupId})
+	if err != nil {
+		return group, err
+	}
+	if len(entries) == 0 {
+		return group, fiber.NewError(fiber.StatusForbidden, "the archived group is unknown, restore a copy of it with freshIds")
+	}
+	err = model.LastState(entries, &group)
+	return group, err
+}
+
+// restoreUser recreates a user of an archive that no longer exists, existing users are left as they are
+func (api *Api) restoreUser(ctx context.Context, user *model.User) error {
+	_, err := api.users.Get(ctx, user.Id)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	// archives have no password, and the email may belong to another account by now
+	restored := model.User{Id: user.Id, Name: user.Name, Version: user.Version + 1}
+	return api.users.InsertWithId(ctx, &restored)
+}
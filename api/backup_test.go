@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRestoreForgedBackup(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	// eve shares no group with the others
+	eve := a.signup("eve")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id}}, &group)
+	var eveGroup model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", eve.Token, model.Group{Name: "alone", Users: []primitive.ObjectID{eve.User.Id}}, &eveGroup)
+
+	// eve makes herself the owner of the group of ann, and charges her a debt
+	ghost := primitive.NewObjectID()
+	forged := model.GroupBackup{
+		Version: model.BackupVersion,
+		Group: model.Group{
+			Id:    group.Id,
+			Name:  "trip",
+			Users: []primitive.ObjectID{ann.User.Id, bob.User.Id, eve.User.Id, ghost},
+			Roles: []model.GroupRole{{User: eve.User.Id, Role: model.RoleOwner}, {User: ann.User.Id, Role: model.RoleOwner}},
+		},
+		Users: []model.User{{Id: ann.User.Id, Name: "ann"}, {Id: bob.User.Id, Name: "bob"}, {Id: eve.User.Id, Name: "eve"}, {Id: ghost, Name: "ghost"}},
+		Transactions: []model.Transaction{
+			expenseFor(group.Id, eve.User.Id, 1000, ann.User.Id),
+			expenseFor(group.Id, eve.User.Id, 500, ghost),
+		},
+	}
+	a.mustDo(fiber.StatusForbidden, "POST", "/groups/restore", eve.Token, forged, nil)
+
+	// a copy only keeps the users eve knows and the ones the restore recreates
+	var copied model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups/restore?freshIds=true", eve.Token, forged, &copied)
+	if len(copied.Users) != 2 || copied.HasMember(ann.User.Id) || copied.HasMember(bob.User.Id) || !copied.HasMember(eve.User.Id) || !copied.HasMember(ghost) {
+		t.Errorf("users of the copy = %v, want eve and the recreated user", copied.Users)
+	}
+	if copied.RoleOf(eve.User.Id) != model.RoleOwner || copied.RoleOf(ghost) != model.RoleMember {
+		t.Errorf("roles of the copy = %v, want eve as the only owner", copied.Roles)
+	}
+	var balances map[string]model.Balance
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+copied.Id.Hex()+"/balances", eve.Token, nil, &balances)
+	if got := balances[eve.User.Id.Hex()].TotalAmount; got != 500 {
+		t.Errorf("balance of eve = %d, want 500 from the transaction with the recreated user only", got)
+	}
+
+	// bob shares a group with ann, he is kept in his copy but ann is the only owner
+	forged.Group.Roles = []model.GroupRole{{User: bob.User.Id, Role: model.RoleOwner}}
+	forged.Group.Users = []primitive.ObjectID{ann.User.Id, bob.User.Id}
+	forged.Users = forged.Users[:2]
+	forged.Transactions = []model.Transaction{expenseFor(group.Id, ann.User.Id, 1000, bob.User.Id)}
+	a.mustDo(fiber.StatusOK, "POST", "/groups/restore?freshIds=true", ann.Token, forged, &copied)
+	if copied.RoleOf(ann.User.Id) != model.RoleOwner || copied.RoleOf(bob.User.Id) != model.RoleMember {
+		t.Errorf("roles of the copy = %v, want ann as the only owner", copied.Roles)
+	}
+
+	// an unknown group can only be restored as a copy
+	forged.Group.Id = primitive.NewObjectID()
+	forged.Transactions[0].Group = forged.Group.Id
+	a.mustDo(fiber.StatusForbidden, "POST", "/groups/restore", ann.Token, forged, nil)
+}
+
+func TestRestorePurgedGroup(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id}}, &group)
+	var backup model.GroupBackup
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/backup", ann.Token, nil, &backup)
+	a.mustDo(fiber.StatusConflict, "POST", "/groups/restore", ann.Token, backup, nil)
+
+	a.mustDo(fiber.StatusNoContent, "DELETE", "/groups/"+group.Id.Hex(), ann.Token, nil, nil, fiber.HeaderIfMatch, etag(group.Version))
+	if err := a.api.PurgeTrash(context.Background(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the history tells who owned the purged group
+	a.mustDo(fiber.StatusForbidden, "POST", "/groups/restore", bob.Token, backup, nil)
+	var restored model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups/restore", ann.Token, backup, &restored)
+	if restored.Id != group.Id || !restored.HasMember(bob.User.Id) {
+		t.Errorf("restored group = %+v, want the archived one", restored)
+	}
+}
+
+// expenseFor returns an expense of a group paid by paidBy for a single user
+func expenseFor(groupId primitive.ObjectID, paidBy primitive.ObjectID, amount uint32, paidFor primitive.ObjectID) model.Transaction {
+	return model.Transaction{
+		Id:       primitive.NewObjectID(),
+		Group:    groupId,
+		PaidBy:   paidBy,
+		PaidFor:  []*model.TransactionTarget{{User: paidFor, Weight: 1}},
+		Amount:   amount,
+		Date:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Category: "food",
+	}
+}
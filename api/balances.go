@@ -3,80 +3,66 @@ package api
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/triplan-planning/api-go/model"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// groupBalances computes the balance of every member of the group, which must be readable by the current user
+func (api *Api) groupBalances(c *fiber.Ctx, groupId primitive.ObjectID) (map[primitive.ObjectID]*model.Balance, error) {
+	ctx := c.Context()
+	// Step 1 : get group users
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return nil, err
+	}
+	// Step 1 end : users stored in group.users var
+
+	// Step 2 get all transactions in group
+	transactions, err := api.transactions.List(
+		ctx,
+		store.TransactionFilter{Group: groupId},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.ComputeBalances(group.Users, transactions)
+}
+
 // @Summary      Returns the balance of every user in the group
 // @Accept       json
 // @Param        id   path      string  true  "Group ID"
-// @Success      200  {object}  model.Transaction
+// @Success      200  {object}  map[string]model.Balance
 // @Router       /groups/{id}/balances [get]
 func (api *Api) GetGroupBalances(c *fiber.Ctx) error {
-
 	groupId, err := getId(c.Params("id"))
 	if err != nil {
 		return err
 	}
 
-	// Step 1 : get group users
-	groupRaw := api.groupsColl.FindOne(
-		c.Context(),
-		bson.M{"_id": groupId},
-	)
-	if groupRaw.Err() != nil {
-		return groupRaw.Err()
-	}
-	var group model.Group
-	err = groupRaw.Decode(&group)
+	balanceMap, err := api.groupBalances(c, groupId)
 	if err != nil {
 		return err
 	}
-	// Step 1 end : users stored in group.users var
 
-	// Step 2 get all transactions in group
-	transactionsRaw, err := api.transactionsColl.Find(
-		c.Context(),
-		model.Transaction{Group: groupId},
-	)
+	return c.JSON(balanceMap)
+}
+
+// @Summary      Returns the transfers to make to settle the group balances
+// @Accept       json
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.Settlement
+// @Router       /groups/{id}/settlements [get]
+func (api *Api) GetGroupSettlements(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
 	if err != nil {
 		return err
 	}
 
-	var transactions []model.Transaction
-	err = transactionsRaw.All(c.Context(), &transactions)
+	balanceMap, err := api.groupBalances(c, groupId)
 	if err != nil {
 		return err
 	}
 
-	balanceMap := make(map[primitive.ObjectID]*model.Balance)
-	for _, userId := range group.Users {
-		balanceMap[userId] = &model.Balance{
-			PositiveAmount: 0,
-			NegativeAmount: 0,
-			TotalAmount:    0,
-		}
-	}
-
-	for _, transaction := range transactions {
-		err = transaction.ComputePrices()
-		if err != nil {
-			return err
-		}
-		payer := transaction.PaidBy
-		balanceMap[payer].PositiveAmount += transaction.Amount
-
-		for _, target := range transaction.PaidFor {
-			balanceMap[target.User].NegativeAmount += target.ComputedPrice
-		}
-
-	}
-
-	for _, balance := range balanceMap {
-		balance.TotalAmount = int32(
-			balance.PositiveAmount - balance.NegativeAmount,
-		)
-	}
-
-	return c.JSON(balanceMap)
+	return c.JSON(model.Settle(balanceMap))
 }
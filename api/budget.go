@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+)
+
+// PostTransactionResponse is a created transaction, with the limits of the group budget that it pushed over
+type PostTransactionResponse struct {
+	model.Transaction
+	OverBudget *model.BudgetReport `json:"overBudget,omitempty"`
+}
+
+// budgetReport compares the budget of a group to its expenses
+func (api *Api) budgetReport(ctx context.Context, group *model.Group) (model.BudgetReport, error) {
+	budget := model.Budget{}
+	if group.Budget != nil {
+		budget = *group.Budget
+	}
+	stats, err := api.transactions.Stats(ctx, group.Id, 0)
+	if err != nil {
+		return model.BudgetReport{}, err
+	}
+	return budget.Report(group.Currency, stats, group.Users), nil
+}
+
+// @Summary      Returns what was spent and what remains of each limit of the group budget
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  model.BudgetReport
+// @Router       /groups/{id}/budget [get]
+func (api *Api) GetGroupBudget(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	report, err := api.budgetReport(c.Context(), &group)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(report)
+}
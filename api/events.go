@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// eventBuffer is how many events a subscriber can be late by before it is dropped
+	eventBuffer = 32
+	// keepAliveInterval keeps proxies from closing idle event streams
+	keepAliveInterval = 15 * time.Second
+)
+
+// eventBus delivers the events of a group to the streams of its members, in this process only
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan model.Event]bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: map[primitive.ObjectID]map[chan model.Event]bool{}}
+}
+
+// subscribe returns a channel receiving the events of a group, it is closed by the returned function,
+// or by the bus when the subscriber is too late
+func (b *eventBus) subscribe(groupId primitive.ObjectID) (<-chan model.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan model.Event, eventBuffer)
+	if b.subscribers[groupId] == nil {
+		b.subscribers[groupId] = map[chan model.Event]bool{}
+	}
+	b.subscribers[groupId][events] = true
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(groupId, events)
+	}
+}
+
+// remove closes the channel of a subscriber, b.mu must be held
+func (b *eventBus) remove(groupId primitive.ObjectID, events chan model.Event) {
+	if !b.subscribers[groupId][events] {
+		return
+	}
+	delete(b.subscribers[groupId], events)
+	if len(b.subscribers[groupId]) == 0 {
+		delete(b.subscribers, groupId)
+	}
+	close(events)
+}
+
+// publish never blocks: subscribers that are too late are dropped, their clients reconnect and catch up with Last-Event-ID
+func (b *eventBus) publish(event model.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for events := range b.subscribers[event.Group] {
+		select {
+		case events <- event:
+		default:
+			b.remove(event.Group, events)
+		}
+	}
+}
+
+type pendingEventsKey struct{}
+
+// publish sends an event to the members of its group and to its webhooks. Inside withTransaction, it is sent once the transaction is committed.
+func (api *Api) publish(ctx context.Context, event model.Event) {
+	if pending, ok := ctx.Value(pendingEventsKey{}).(*[]model.Event); ok {
+		*pending = append(*pending, event)
+		return
+	}
+	api.events.publish(event)
+	api.enqueueDeliveries(ctx, event)
+}
+
+// withTransaction runs fn in a store transaction, publishing its events only if it succeeds
+func (api *Api) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	var pending []model.Event
+	err := api.Store.WithTransaction(ctx, func(ctx context.Context) error {
+		// the transaction may be retried
+		pending = nil
+		return fn(context.WithValue(ctx, pendingEventsKey{}, &pending))
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range pending {
+		api.publish(ctx, event)
+	}
+	return nil
+}
+
+// writeEvent writes an event in the text/event-stream format and sends it
+func writeEvent(w *bufio.Writer, event *model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Id.Hex(), event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// @Summary      Streams the changes made to a group and its transactions as server-sent events
+// @Description  Each event has the id of the history entry of the change, sending it back in Last-Event-ID replays the events missed since.
+// @Description  The stream ends when the current user is no longer a member of the group.
+// @Produce      text/event-stream
+// @Param        id   path      string  true  "Group ID"
+// @Param        Last-Event-ID  header  string  false  "Id of the last event received"
+// @Success      200  {object}  model.Event
+// @Router       /groups/{id}/events [get]
+func (api *Api) GetGroupEvents(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.memberGroup(c, groupId); err != nil {
+		return err
+	}
+	var lastEventId primitive.ObjectID
+	if raw := c.Get("Last-Event-ID"); raw != "" {
+		lastEventId, err = primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, `header "Last-Event-ID" must be the id of an event`)
+		}
+	}
+
+	// subscribing before reading the missed events leaves no gap between them
+	events, unsubscribe := api.events.subscribe(groupId)
+	missed := []model.HistoryEntry{}
+	if !lastEventId.IsZero() {
+		entries, err := api.history.List(c.Context(), store.HistoryFilter{Group: groupId})
+		if err != nil {
+			unsubscribe()
+			return err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Id.Hex() > lastEventId.Hex() {
+				missed = append(missed, entries[i])
+			}
+		}
+	}
+
+	userId := currentUser(c).Id
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		if err := api.streamEvents(w, groupId, userId, missed, events); err != nil {
+			log.Printf("event stream of group %s ended: %v", groupId.Hex(), err)
+		}
+	})
+	return nil
+}
+
+// streamEvents writes the missed events then the published ones, until the client goes away or leaves the group
+func (api *Api) streamEvents(w *bufio.Writer, groupId primitive.ObjectID, userId primitive.ObjectID, missed []model.HistoryEntry, events <-chan model.Event) error {
+	last := ""
+	for i := range missed {
+		event := model.NewEvent(&missed[i])
+		if err := writeEvent(w, &event); err != nil {
+			return err
+		}
+		last = event.Id.Hex()
+	}
+	// an empty comment makes the headers go out before the first event
+	if _, err := w.WriteString(": connected\n\n"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("the client was too late")
+			}
+			// published events may have been replayed already
+			if event.Id.Hex() <= last {
+				continue
+			}
+			if err := writeEvent(w, &event); err != nil {
+				return err
+			}
+			if event.Type == model.EventMembersChanged || event.Type == model.EventGroupDeleted {
+				// the request context can not be used once the handler returned
+				group, err := api.groups.Get(context.Background(), groupId)
+				if err != nil || group.DeletedAt != nil || !group.HasMember(userId) {
+					return nil
+				}
+			}
+		case <-keepAlive.C:
+			if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// exportPageSize is the number of transactions read from the store at once while exporting
+const exportPageSize = 500
+
+// userNames returns the names of the given users, users that no longer exist are named by their id
+func (api *Api) userNames(ctx context.Context, userIds []primitive.ObjectID) (func(primitive.ObjectID) string, error) {
+	users, err := api.users.List(ctx, store.UserFilter{Ids: userIds})
+	if err != nil {
+		return nil, err
+	}
+	names := map[primitive.ObjectID]string{}
+	for _, user := range users {
+		names[user.Id] = user.Name
+	}
+	return func(userId primitive.ObjectID) string {
+		if name, ok := names[userId]; ok {
+			return name
+		}
+		return userId.Hex()
+	}, nil
+}
+
+// csvText keeps spreadsheets from reading text starting like a formula as one
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func csvAmount(amount uint32) string {
+	return strconv.FormatUint(uint64(amount), 10)
+}
+
+// setCSVAttachment makes the response a CSV file downloaded with the given name
+func setCSVAttachment(c *fiber.Ctx, filename string) {
+	c.Attachment(filename)
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+}
+
+// @Summary      Exports the transactions of a group as CSV, oldest first
+// @Description  Each transaction has the name of its payer and one column per member with their computed share, in the currency of the transaction.
+// @Produce      text/csv
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {file}    file
+// @Router       /groups/{id}/export.csv [get]
+func (api *Api) ExportGroupTransactions(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	// former members keep their share in the transactions they were part of
+	columns := append(append([]primitive.ObjectID{}, group.Users...), group.FormerUsers...)
+	name, err := api.userNames(c.Context(), columns)
+	if err != nil {
+		return err
+	}
+
+	setCSVAttachment(c, group.Id.Hex()+"-transactions.csv")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// the request context can not be used once the handler returned
+		if err := api.writeTransactionsCSV(context.Background(), w, group.Id, columns, name); err != nil {
+			log.Printf("could not export the transactions of group %s: %v", group.Id.Hex(), err)
+		}
+	})
+	return nil
+}
+
+// writeTransactionsCSV writes the transactions of a group one page at a time, so that they are never all in memory
+func (api *Api) writeTransactionsCSV(ctx context.Context, w *bufio.Writer, groupId primitive.ObjectID, columns []primitive.ObjectID, name func(primitive.ObjectID) string) error {
+	out := csv.NewWriter(w)
+	header := []string{"id", "date", "kind", "title", "category", "paid by", "amount", "currency", "exchange rate"}
+	for _, userId := range columns {
+		header = append(header, csvText(name(userId)))
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	page := store.Page{Sort: store.SortDate, Limit: exportPageSize}
+	for {
+		transactions, err := api.transactions.List(ctx, store.TransactionFilter{Group: groupId, Page: page})
+		if err != nil {
+			return err
+		}
+		for _, transaction := range transactions {
+			// the shares are the computed prices stored with the transaction, as in the stats
+			shares := map[primitive.ObjectID]uint32{}
+			for _, target := range transaction.PaidFor {
+				shares[target.User] += target.ComputedPrice
+			}
+
+			record := []string{
+				transaction.Id.Hex(),
+				transaction.Date.UTC().Format(time.RFC3339),
+				string(transaction.GetKind()),
+				csvText(transaction.Title),
+				csvText(transaction.Category),
+				csvText(name(transaction.PaidBy)),
+				csvAmount(transaction.Amount),
+				transaction.Currency,
+				strconv.FormatFloat(transaction.ExchangeRate, 'f', -1, 64),
+			}
+			for _, userId := range columns {
+				share, ok := shares[userId]
+				if !ok {
+					record = append(record, "")
+					continue
+				}
+				record = append(record, csvAmount(share))
+			}
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+
+		// sends the page to the client, failing when it went away
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if len(transactions) < page.Limit {
+			return nil
+		}
+		cursor := store.TransactionCursor(&transactions[len(transactions)-1], page.Sort)
+		page.After = &cursor
+	}
+}
+
+// @Summary      Exports the balance of every user in the group as CSV, in the group currency
+// @Produce      text/csv
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {file}    file
+// @Router       /groups/{id}/balances.csv [get]
+func (api *Api) ExportGroupBalances(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+	balanceMap, err := api.groupBalances(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	// members first, then the former members still having a balance
+	userIds := append([]primitive.ObjectID{}, group.Users...)
+	others := []primitive.ObjectID{}
+	for userId := range balanceMap {
+		if !group.HasMember(userId) {
+			others = append(others, userId)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Hex() < others[j].Hex()
+	})
+	userIds = append(userIds, others...)
+	name, err := api.userNames(c.Context(), userIds)
+	if err != nil {
+		return err
+	}
+
+	setCSVAttachment(c, group.Id.Hex()+"-balances.csv")
+	out := csv.NewWriter(c)
+	if err := out.Write([]string{"user", "name", "paid", "share", "balance", "currency"}); err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		balance := balanceMap[userId]
+		err := out.Write([]string{
+			userId.Hex(),
+			csvText(name(userId)),
+			csvAmount(balance.PositiveAmount),
+			csvAmount(balance.NegativeAmount),
+			strconv.FormatInt(int64(balance.TotalAmount), 10),
+			group.Currency,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
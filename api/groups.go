@@ -1,36 +1,44 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/triplan-planning/api-go/model"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (api *Api) GetGroups(c *fiber.Ctx) error {
-	limitUser := c.Query("user")
-	filter := bson.M{}
-	if limitUser != "" {
+	filter := store.GroupFilter{User: currentUser(c).Id}
+	if limitUser := c.Query("user"); limitUser != "" {
 		uid, err := getId(limitUser)
 		if err != nil {
 			return err
 		}
-		filter["users"] = uid
+		if uid != filter.User {
+			return fiber.NewError(fiber.StatusForbidden, "you can only list your own groups")
+		}
 	}
-	res, err := api.groupsColl.Find(c.Context(), filter)
+
+	page, err := pageQuery(c, store.SortCreated, store.SortCreated, store.SortName)
 	if err != nil {
 		return err
 	}
+	filter.Page = page
 
-	var trips []model.Group
-	err = res.All(c.Context(), &trips)
+	trips, err := api.groups.List(c.Context(), filter)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(trips)
+	response, err := newPage(trips, page, store.GroupCursor)
+	if err != nil {
+		return err
+	}
+	return c.JSON(response)
 }
 
 func (api *Api) GetGroupInfo(c *fiber.Ctx) error {
@@ -39,19 +47,12 @@ func (api *Api) GetGroupInfo(c *fiber.Ctx) error {
 		return err
 	}
 
-	res := api.groupsColl.FindOne(c.Context(), bson.M{
-		"_id": tripId,
-	})
-	if res.Err() != nil {
-		return res.Err()
-	}
-
-	var trip model.Group
-	err = res.Decode(&trip)
+	trip, err := api.memberGroup(c, tripId)
 	if err != nil {
 		return err
 	}
 
+	setETag(c, trip.Version)
 	return c.JSON(trip)
 }
 
@@ -61,14 +62,7 @@ func (api *Api) GetUsersFromGroup(c *fiber.Ctx) error {
 		return err
 	}
 
-	res := api.groupsColl.FindOne(c.Context(), bson.M{
-		"_id": tripId,
-	})
-	if res.Err() != nil {
-		return res.Err()
-	}
-	var trip model.Group
-	err = res.Decode(&trip)
+	trip, err := api.memberGroup(c, tripId)
 	if err != nil {
 		return err
 	}
@@ -76,51 +70,75 @@ func (api *Api) GetUsersFromGroup(c *fiber.Ctx) error {
 	if len(trip.Users) == 0 {
 		return c.JSON([]model.User{})
 	}
-	resUsers, err := api.usersColl.Find(c.Context(), bson.M{
-		"_id": bson.M{"$in": trip.Users},
-	})
-	if err != nil {
-		return err
-	}
-	var users []model.User
-	err = resUsers.All(c.Context(), &users)
+	users, err := api.users.List(c.Context(), store.UserFilter{Ids: trip.Users})
 	if err != nil {
 		return err
 	}
+	hideEmails(c, users)
 
 	return c.JSON(users)
 }
 
-func (api *Api) PostGroup(c *fiber.Ctx) error {
-	var trip model.Group
-	err := c.BodyParser(&trip)
-	if err != nil {
-		return err
-	}
+// validateGroup checks the fields of a group sent by a client
+func (api *Api) validateGroup(ctx context.Context, trip *model.Group) error {
 	if trip.Name == "" {
 		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
 	}
 	if len(trip.Users) == 0 {
 		return fiber.NewError(fiber.StatusBadRequest, `field "users" must be non-empty`)
 	}
-	cnt, err := api.usersColl.CountDocuments(c.Context(), bson.M{
-		"_id": bson.M{"$in": trip.Users},
-	})
+	cnt, err := api.users.Count(ctx, trip.Users)
 	if err != nil {
 		return err
 	}
 	if cnt != int64(len(trip.Users)) {
 		return fmt.Errorf(`%w: field "users" must be a list of valid users: got %d valid users out of %d`, fiber.ErrBadRequest, cnt, len(trip.Users))
 	}
+	if err := trip.ValidateCurrencies(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := trip.ValidateRoles(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if trip.Budget != nil {
+		if err := trip.Budget.Validate(); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	return nil
+}
 
-	trip.Id = primitive.NilObjectID
+func (api *Api) PostGroup(c *fiber.Ctx) error {
+	var trip model.Group
+	err := c.BodyParser(&trip)
+	if err != nil {
+		return err
+	}
 
-	res, err := api.groupsColl.InsertOne(c.Context(), trip)
+	// the creator of the group is its owner
+	me := currentUser(c).Id
+	if !trip.HasMember(me) {
+		trip.Users = append(trip.Users, me)
+	}
+	trip.Roles = []model.GroupRole{{User: me, Role: model.RoleOwner}}
+	trip.FormerUsers = nil
+	trip.DeletedAt = nil
+
+	if err := api.validateGroup(c.Context(), &trip); err != nil {
+		return err
+	}
+
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.groups.Insert(ctx, &trip); err != nil {
+			return err
+		}
+		return api.recordGroup(ctx, c, model.ActionCreate, nil, &trip)
+	})
 	if err != nil {
 		return err
 	}
-	trip.Id = res.InsertedID.(primitive.ObjectID)
 
+	setETag(c, trip.Version)
 	return c.JSON(trip)
 }
 
@@ -129,11 +147,25 @@ func (api *Api) DeleteGroup(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	trip, err := api.groupWithRole(c, tripId, model.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, trip.Version); err != nil {
+		return err
+	}
 
-	_, err = api.groupsColl.DeleteOne(c.Context(), bson.M{
-		"_id": tripId,
+	// the group goes to the trash, see PurgeTrash
+	now := time.Now()
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.groups.SetDeletedAt(ctx, tripId, trip.Version, &now); err != nil {
+			return versionConflict(err, "group")
+		}
+		deleted := trip
+		deleted.DeletedAt = &now
+		deleted.Version++
+		return api.recordGroup(ctx, c, model.ActionDelete, &trip, &deleted)
 	})
-
 	if err != nil {
 		return err
 	}
@@ -142,47 +174,110 @@ func (api *Api) DeleteGroup(c *fiber.Ctx) error {
 	return nil
 }
 
-func (api *Api) PutGroup(c *fiber.Ctx) error {
+// editedGroup returns the group the request is about if the current user can edit it and the request has its version
+func (api *Api) editedGroup(c *fiber.Ctx) (model.Group, error) {
 	tripId, err := getId(c.Params("id"))
 	if err != nil {
-		return err
+		return model.Group{}, err
 	}
-
-	var trip model.Group
-	err = c.BodyParser(&trip)
+	stored, err := api.groupWithRole(c, tripId, model.RoleAdmin)
 	if err != nil {
+		return stored, err
+	}
+	if err := checkIfMatch(c, stored.Version); err != nil {
+		return stored, err
+	}
+	return stored, nil
+}
+
+// updateGroup validates trip and replaces the stored group with it
+func (api *Api) updateGroup(c *fiber.Ctx, stored model.Group, trip model.Group) error {
+	// only owners can change roles
+	if stored.RoleOf(currentUser(c).Id) != model.RoleOwner || trip.Roles == nil {
+		// members removed by this update lose their role
+		trip.Roles = []model.GroupRole{}
+		for _, role := range stored.Roles {
+			if trip.HasMember(role.User) {
+				trip.Roles = append(trip.Roles, role)
+			}
+		}
+	}
+	if len(trip.Roles) == 0 {
+		// groups created before roles existed get their first owner from their first update
+		trip.Roles = []model.GroupRole{{User: currentUser(c).Id, Role: model.RoleOwner}}
+	}
+	if err := api.validateGroup(c.Context(), &trip); err != nil {
 		return err
 	}
-	if trip.Name == "" {
-		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
+	trip.Id = stored.Id
+	trip.DeletedAt = nil
+	trip.Version = stored.Version
+
+	// removed members must have settled their balance, see DeleteGroupMember
+	trip.FormerUsers = []primitive.ObjectID{}
+	for _, userId := range stored.FormerUsers {
+		if !trip.HasMember(userId) {
+			trip.FormerUsers = append(trip.FormerUsers, userId)
+		}
 	}
-	if len(trip.Users) == 0 {
-		return fiber.NewError(fiber.StatusBadRequest, `field "users" must be non-empty`)
+	for _, userId := range stored.Users {
+		if trip.HasMember(userId) {
+			continue
+		}
+		if err := checkRemovalRole(c, &stored, userId); err != nil {
+			return err
+		}
+		keepAsFormer, err := api.checkMemberRemoval(c.Context(), &stored, userId)
+		if err != nil {
+			return err
+		}
+		if keepAsFormer {
+			trip.FormerUsers = append(trip.FormerUsers, userId)
+		}
 	}
-	cnt, err := api.usersColl.CountDocuments(c.Context(), bson.M{
-		"_id": bson.M{"$in": trip.Users},
+
+	err := api.withTransaction(c.Context(), func(ctx context.Context) error {
+		// a retried transaction replaces the stored version again
+		trip.Version = stored.Version
+		if err := api.groups.Replace(ctx, &trip); err != nil {
+			return versionConflict(err, "group")
+		}
+		return api.recordGroup(ctx, c, model.ActionUpdate, &stored, &trip)
 	})
 	if err != nil {
 		return err
 	}
-	if cnt != int64(len(trip.Users)) {
-		return fmt.Errorf(`%w: field "users" must be a list of valid users: got %d valid users out of %d`, fiber.ErrBadRequest, cnt, len(trip.Users))
+
+	setETag(c, trip.Version)
+	return c.JSON(trip)
+}
+
+func (api *Api) PutGroup(c *fiber.Ctx) error {
+	stored, err := api.editedGroup(c)
+	if err != nil {
+		return err
 	}
 
-	trip.Id = tripId
+	var trip model.Group
+	err = c.BodyParser(&trip)
 	if err != nil {
 		return err
 	}
 
-	res, err := api.groupsColl.ReplaceOne(c.Context(), bson.M{
-		"_id": trip.Id,
-	}, trip)
+	return api.updateGroup(c, stored, trip)
+}
+
+// PatchGroup applies the JSON merge patch (RFC 7396) in the body to a group
+func (api *Api) PatchGroup(c *fiber.Ctx) error {
+	stored, err := api.editedGroup(c)
 	if err != nil {
 		return err
 	}
-	if res.ModifiedCount != 1 {
-		return fmt.Errorf("could not update trip")
+
+	trip, err := mergePatch(c, &stored)
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(trip)
+	return api.updateGroup(c, stored, trip)
 }
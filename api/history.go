@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// record appends the change of an entity made by the current user to the history,
+// ctx is the one of the transaction writing the change so that both are committed together
+func (api *Api) record(ctx context.Context, c *fiber.Ctx, entity model.HistoryEntity, entityId primitive.ObjectID, groupId primitive.ObjectID, action model.HistoryAction, before any, after any) error {
+	return api.recordBy(ctx, currentUser(c).Id, entity, entityId, groupId, action, before, after)
+}
+
+// recordBy appends the change of an entity made on behalf of actor to the history and publishes its event
+func (api *Api) recordBy(ctx context.Context, actor primitive.ObjectID, entity model.HistoryEntity, entityId primitive.ObjectID, groupId primitive.ObjectID, action model.HistoryAction, before any, after any) error {
+	changes, err := model.Diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	entry := model.HistoryEntry{
+		Entity:   entity,
+		EntityId: entityId,
+		Group:    groupId,
+		Action:   action,
+		Actor:    actor,
+		Time:     time.Now(),
+		Changes:  changes,
+	}
+	if err := api.history.Insert(ctx, &entry); err != nil {
+		return err
+	}
+	// every recorded change is also pushed to the members following the group
+	api.publish(ctx, model.NewEvent(&entry))
+	return nil
+}
+
+// recordGroup appends the change of a group to the history, before is nil for a creation
+func (api *Api) recordGroup(ctx context.Context, c *fiber.Ctx, action model.HistoryAction, before *model.Group, after *model.Group) error {
+	return api.record(ctx, c, model.EntityGroup, after.Id, after.Id, action, before, after)
+}
+
+// recordTransaction appends the change of a transaction to the history, before is nil for a creation
+func (api *Api) recordTransaction(ctx context.Context, c *fiber.Ctx, action model.HistoryAction, before *model.Transaction, after *model.Transaction) error {
+	return api.record(ctx, c, model.EntityTransaction, after.Id, after.Group, action, before, after)
+}
+
+// @Summary      Returns every change made to a transaction, newest first
+// @Param        id   path      string  true  "Transaction ID"
+// @Success      200  {array}   model.HistoryEntry
+// @Router       /transactions/{id}/history [get]
+func (api *Api) GetTransactionHistory(c *fiber.Ctx) error {
+	transactionId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	// the history of transactions in the trash stays readable
+	transaction, err := api.transactions.Get(c.Context(), transactionId)
+	if err != nil {
+		return notFound(err, "transaction")
+	}
+	if _, err := api.memberGroup(c, transaction.Group); err != nil {
+		return err
+	}
+
+	entries, err := api.history.List(c.Context(), store.HistoryFilter{EntityId: transactionId})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(entries)
+}
+
+// @Summary      Returns every change made to a group and its transactions, newest first
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.HistoryEntry
+// @Router       /groups/{id}/activity [get]
+func (api *Api) GetGroupActivity(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.memberGroup(c, groupId); err != nil {
+		return err
+	}
+
+	entries, err := api.history.List(c.Context(), store.HistoryFilter{Group: groupId})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(entries)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+const (
+	// IdempotencyKeyTTL is how long the response to a request sent with an Idempotency-Key header is replayed
+	IdempotencyKeyTTL       = 24 * time.Hour
+	headerIdempotencyKey    = "Idempotency-Key"
+	headerIdempotentReplay  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+// fingerprint identifies a request by its method, path and body
+func fingerprint(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Idempotent is a middleware replaying the response to a request when it is sent again with the same
+// Idempotency-Key header. Keys are scoped to the user, it must run after Authenticate.
+func (api *Api) Idempotent(c *fiber.Ctx) error {
+	key := c.Get(headerIdempotencyKey)
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return fiber.NewError(fiber.StatusBadRequest, `header "Idempotency-Key" must be at most 255 characters long`)
+	}
+
+	now := time.Now()
+	request := model.IdempotentRequest{
+		Key:         currentUser(c).Id.Hex() + ":" + key,
+		Fingerprint: fingerprint(c),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyKeyTTL),
+	}
+	err := api.idempotency.Insert(c.Context(), &request)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return api.replay(c, request)
+	}
+	if err != nil {
+		return err
+	}
+
+	// failed requests are not replayed, the client can retry them with the same key
+	err = c.Next()
+	if err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError {
+		if err := api.idempotency.Delete(c.Context(), request.Key); err != nil {
+			log.Printf("could not release the idempotency key %q: %v", request.Key, err)
+		}
+		return err
+	}
+
+	response := c.Response()
+	request.Completed = true
+	request.Status = response.StatusCode()
+	request.ContentType = string(response.Header.ContentType())
+	request.ETag = string(response.Header.Peek(fiber.HeaderETag))
+	request.Body = append([]byte(nil), response.Body()...)
+	if err := api.idempotency.Replace(c.Context(), &request); err != nil {
+		// the write succeeded, the client gets its response and the key is released rather than left in progress
+		log.Printf("could not store the response to the idempotency key %q: %v", request.Key, err)
+		if err := api.idempotency.Delete(c.Context(), request.Key); err != nil {
+			log.Printf("could not release the idempotency key %q: %v", request.Key, err)
+		}
+	}
+	return nil
+}
+
+// replay sends the stored response to the first request made with the key of request
+func (api *Api) replay(c *fiber.Ctx, request model.IdempotentRequest) error {
+	stored, err := api.idempotency.Get(c.Context(), request.Key)
+	if errors.Is(err, store.ErrNotFound) {
+		// the first request failed in the meantime
+		return fiber.NewError(fiber.StatusConflict, "a request with this Idempotency-Key was being processed, retry it")
+	}
+	if err != nil {
+		return err
+	}
+	if stored.Fingerprint != request.Fingerprint {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, `header "Idempotency-Key" was already used for another request`)
+	}
+	if !stored.Completed {
+		return fiber.NewError(fiber.StatusConflict, "a request with this Idempotency-Key is still being processed")
+	}
+
+	c.Set(headerIdempotentReplay, "true")
+	c.Set(fiber.HeaderContentType, stored.ContentType)
+	if stored.ETag != "" {
+		c.Set(fiber.HeaderETag, stored.ETag)
+	}
+	return c.Status(stored.Status).Send(stored.Body)
+}
+
+// RunIdempotencyCleanup deletes the expired idempotency keys every interval until ctx is done
+func (api *Api) RunIdempotencyCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.idempotency.DeleteExpired(ctx, time.Now()); err != nil {
+			log.Printf("could not delete the expired idempotency keys: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+// failingReplace is an idempotency store whose responses can not be stored
+type failingReplace struct {
+	store.IdempotentRequestStore
+}
+
+func (failingReplace) Replace(ctx context.Context, request *model.IdempotentRequest) error {
+	return errors.New("idempotency keys are down")
+}
+
+func TestIdempotentReplaceFailure(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	calls := 0
+	a.app.Post("/idempotent", a.api.Authenticate, a.api.Idempotent, func(c *fiber.Ctx) error {
+		calls++
+		return c.JSON(calls)
+	})
+
+	a.api.idempotency = failingReplace{a.api.idempotency}
+	var got int
+	// the write succeeded, its response is sent even though it could not be stored
+	a.mustDo(fiber.StatusOK, "POST", "/idempotent", ann.Token, nil, &got, headerIdempotencyKey, "key")
+	if got != 1 {
+		t.Errorf("response = %d, want 1", got)
+	}
+	// the key is not left in progress
+	a.mustDo(fiber.StatusOK, "POST", "/idempotent", ann.Token, nil, &got, headerIdempotencyKey, "key")
+	if got != 2 {
+		t.Errorf("response to the retry = %d, want 2", got)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImportRequest struct {
+	Format model.ImportFormat `json:"format"`
+	// Data is the content of the CSV file
+	Data string `json:"data"`
+	// Mapping gives the member of each name of the file, names that are the name of a single member can be left out
+	Mapping map[string]primitive.ObjectID `json:"mapping,omitempty"`
+	// DryRun only reports what would be imported
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// memberResolver resolves the names of an imported file to members of the group, from the mapping first
+func (api *Api) memberResolver(ctx context.Context, group *model.Group, mapping map[string]primitive.ObjectID) (func(string) (primitive.ObjectID, bool), error) {
+	for _, userId := range mapping {
+		if !group.HasMember(userId) {
+			return nil, fmt.Errorf(`%w: field "mapping" must only map names to members of the group`, fiber.ErrBadRequest)
+		}
+	}
+
+	name, err := api.userNames(ctx, group.Users)
+	if err != nil {
+		return nil, err
+	}
+	// names shared by several members are ambiguous, they must be mapped
+	byName := map[string][]primitive.ObjectID{}
+	for _, userId := range group.Users {
+		key := strings.ToLower(name(userId))
+		byName[key] = append(byName[key], userId)
+	}
+
+	return func(fileName string) (primitive.ObjectID, bool) {
+		if userId, ok := mapping[fileName]; ok {
+			return userId, true
+		}
+		if members := byName[strings.ToLower(fileName)]; len(members) == 1 {
+			return members[0], true
+		}
+		return primitive.NilObjectID, false
+	}, nil
+}
+
+// @Summary      Imports transactions from the CSV export of Splitwise or Tricount
+// @Description  Lines that are not valid transactions of the group are rejected and reported, the others are created unless dryRun is set.
+// @Description  Amounts of the file are converted to hundredths.
+// @Accept       json
+// @Param        id   path      string  true  "Group ID"
+// @Param        import  body      ImportRequest  true  "The file and how to read it"
+// @Success      200  {object}  model.ImportReport
+// @Router       /groups/{id}/import [post]
+func (api *Api) ImportGroupTransactions(c *fiber.Ctx) error {
+	var request ImportRequest
+	err := c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	resolve, err := api.memberResolver(c.Context(), &group, request.Mapping)
+	if err != nil {
+		return err
+	}
+	parsed, err := model.ParseImport(request.Format, strings.NewReader(request.Data), group.Currency, resolve)
+	if err != nil {
+		return fmt.Errorf("%w: %s", fiber.ErrBadRequest, err.Error())
+	}
+
+	// lines are checked like the transactions sent to POST /groups/{id}/transactions
+	report := parsed
+	report.DryRun = request.DryRun
+	report.Accepted = []model.ImportLine{}
+	for _, line := range parsed.Accepted {
+		if err := checkImported(&group, line.Transaction); err != nil {
+			line.Error = strings.TrimSpace(err.Error())
+			line.Transaction = nil
+			report.Rejected = append(report.Rejected, line)
+			continue
+		}
+		report.Accepted = append(report.Accepted, line)
+	}
+	sort.Slice(report.Rejected, func(i, j int) bool {
+		return report.Rejected[i].Line < report.Rejected[j].Line
+	})
+
+	if request.DryRun {
+		return c.JSON(report)
+	}
+
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		for _, line := range report.Accepted {
+			if err := api.transactions.Insert(ctx, line.Transaction); err != nil {
+				return err
+			}
+			if err := api.recordBy(ctx, currentUser(c).Id, model.EntityTransaction, line.Transaction.Id, groupId, model.ActionCreate, nil, line.Transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(report)
+}
+
+// checkImported validates an imported transaction of the group and computes its prices
+func checkImported(group *model.Group, transaction *model.Transaction) error {
+	transaction.Group = group.Id
+	if err := transaction.Validate(); err != nil {
+		return err
+	}
+	transaction.Kind = transaction.GetKind()
+	if err := transaction.ResolveExchangeRate(group); err != nil {
+		return err
+	}
+	if err := checkTransactionMembers(group, transaction); err != nil {
+		return err
+	}
+	return transaction.ComputePrices()
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+type InvitationRequest struct {
+	// ExpiresAt is optional, the invitation never expires without it
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// MaxUses is optional, the invitation can be used any number of times without it
+	MaxUses uint32 `json:"maxUses,omitempty"`
+}
+
+// @Summary      Returns the invitations of a group
+// @Description  Their tokens are not listed, they are only sent when an invitation is created
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.Invitation
+// @Router       /groups/{id}/invitations [get]
+func (api *Api) GetGroupInvitations(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.groupWithRole(c, groupId, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	invitations, err := api.invitations.List(c.Context(), groupId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(invitations)
+}
+
+// @Summary      Creates an invitation to join a group
+// @Description  The response is the only one with the token of the invitation
+// @Accept       json
+// @Param        id   path      string  true  "Group ID"
+// @Param        invitation  body      InvitationRequest  false  "Limits of the invitation"
+// @Success      200  {object}  model.Invitation
+// @Router       /groups/{id}/invitations [post]
+func (api *Api) PostGroupInvitation(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.groupWithRole(c, groupId, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	var request InvitationRequest
+	if len(c.Body()) != 0 {
+		err = c.BodyParser(&request)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return fiber.NewError(fiber.StatusBadRequest, `field "expiresAt" must be in the future`)
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	invitation := model.Invitation{
+		Group:     groupId,
+		TokenHash: hashToken(token),
+		CreatedBy: currentUser(c).Id,
+		CreatedAt: now,
+		ExpiresAt: request.ExpiresAt,
+		MaxUses:   request.MaxUses,
+	}
+	err = api.invitations.Insert(c.Context(), &invitation)
+	if err != nil {
+		return err
+	}
+	// the token can not be read again, only its hash is stored
+	invitation.Token = token
+
+	return c.JSON(invitation)
+}
+
+// @Summary      Revokes an invitation
+// @Param        id            path      string  true  "Group ID"
+// @Param        invitationId  path      string  true  "Invitation ID"
+// @Success      204
+// @Router       /groups/{id}/invitations/{invitationId} [delete]
+func (api *Api) DeleteGroupInvitation(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	invitationId, err := getId(c.Params("invitationId"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.groupWithRole(c, groupId, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	invitation, err := api.invitations.Get(c.Context(), invitationId)
+	if err != nil {
+		return notFound(err, "invitation")
+	}
+	if invitation.Group != groupId {
+		return notFound(store.ErrNotFound, "invitation")
+	}
+	if invitation.RevokedAt == nil {
+		now := time.Now()
+		invitation.RevokedAt = &now
+		err = api.invitations.Replace(c.Context(), &invitation)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Status(fiber.StatusNoContent)
+	return nil
+}
+
+// @Summary      Joins the group of an invitation
+// @Param        token  path      string  true  "Invitation token"
+// @Success      200  {object}  model.Group
+// @Router       /groups/join/{token} [post]
+func (api *Api) JoinGroup(c *fiber.Ctx) error {
+	invitation, err := api.invitations.GetByToken(c.Context(), hashToken(c.Params("token")))
+	if err != nil {
+		return notFound(err, "invitation")
+	}
+
+	group, err := api.groups.Get(c.Context(), invitation.Group)
+	if err != nil {
+		return notFound(err, "group")
+	}
+	if group.DeletedAt != nil {
+		return fiber.NewError(fiber.StatusGone, "this invitation is no longer valid")
+	}
+	me := currentUser(c).Id
+	if group.HasMember(me) {
+		setETag(c, group.Version)
+		return c.JSON(group)
+	}
+
+	var after model.Group
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		// revoked, expired and used up invitations are refused by the same update counting the use
+		err := api.invitations.Use(ctx, invitation.Id, time.Now())
+		if errors.Is(err, store.ErrNotFound) {
+			return fiber.NewError(fiber.StatusGone, "this invitation is no longer valid")
+		}
+		if err != nil {
+			return err
+		}
+		if err := api.groups.AddMember(ctx, group.Id, me); err != nil {
+			return notFound(err, "group")
+		}
+		after, err = api.groups.Get(ctx, group.Id)
+		if err != nil {
+			return notFound(err, "group")
+		}
+		return api.recordGroup(ctx, c, model.ActionUpdate, &group, &after)
+	})
+	if err != nil {
+		return err
+	}
+
+	setETag(c, after.Version)
+	return c.JSON(after)
+}
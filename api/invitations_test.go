@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInvitations(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dan := a.signup("dan")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id}}, &group)
+	path := "/groups/" + group.Id.Hex() + "/invitations"
+	var invitation model.Invitation
+	a.mustDo(fiber.StatusOK, "POST", path, ann.Token, InvitationRequest{MaxUses: 1}, &invitation)
+	if invitation.Token == "" {
+		t.Fatal("the created invitation has no token")
+	}
+
+	// only a hash of the token is stored
+	stored, err := a.api.invitations.Get(context.Background(), invitation.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Token != "" || stored.TokenHash != hashToken(invitation.Token) {
+		t.Errorf("stored invitation = %+v, want only the hash of its token", stored)
+	}
+	var invitations []model.Invitation
+	a.mustDo(fiber.StatusOK, "GET", path, ann.Token, nil, &invitations)
+	if len(invitations) != 1 || invitations[0].Token != "" {
+		t.Errorf("listed invitations = %+v, want one without its token", invitations)
+	}
+
+	// the stored hash does not let anyone join
+	a.mustDo(fiber.StatusNotFound, "POST", "/groups/join/"+stored.TokenHash, bob.Token, nil, nil)
+	a.mustDo(fiber.StatusOK, "POST", "/groups/join/"+invitation.Token, bob.Token, nil, nil)
+	a.mustDo(fiber.StatusGone, "POST", "/groups/join/"+invitation.Token, carol.Token, nil, nil)
+
+	var revoked model.Invitation
+	a.mustDo(fiber.StatusOK, "POST", path, ann.Token, nil, &revoked)
+	a.mustDo(fiber.StatusNoContent, "DELETE", path+"/"+revoked.Id.Hex(), ann.Token, nil, nil)
+	a.mustDo(fiber.StatusGone, "POST", "/groups/join/"+revoked.Token, dan.Token, nil, nil)
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MemberRequest struct {
+	User primitive.ObjectID `json:"user"`
+}
+
+// checkMemberRemoval refuses to remove a member whose balance is not settled.
+// It reports whether the member appears in transactions of the group and must be kept as a former member.
+func (api *Api) checkMemberRemoval(ctx context.Context, group *model.Group, userId primitive.ObjectID) (bool, error) {
+	// transactions in the trash can be restored, they count as references but not in the balance
+	transactions, err := api.transactions.List(ctx, store.TransactionFilter{Group: group.Id, Deletion: store.AnyDeletion})
+	if err != nil {
+		return false, err
+	}
+	live := []model.Transaction{}
+	for _, transaction := range transactions {
+		if transaction.DeletedAt == nil {
+			live = append(live, transaction)
+		}
+	}
+	balances, err := model.ComputeBalances(group.Users, live)
+	if err != nil {
+		return false, err
+	}
+	if balance := balances[userId]; balance.TotalAmount != 0 {
+		return false, fmt.Errorf("%w: user %s still has a balance of %d in the group, it must be settled first", fiber.ErrConflict, userId.Hex(), balance.TotalAmount)
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Involves(userId) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkRemovalRole checks that the current user can remove a member of the group: anyone can leave,
+// admins can only remove members and removing an admin or an owner takes an owner
+func checkRemovalRole(c *fiber.Ctx, group *model.Group, userId primitive.ObjectID) error {
+	if userId == currentUser(c).Id {
+		return checkRole(c, group, model.RoleMember)
+	}
+	if group.RoleOf(userId) == model.RoleMember {
+		return checkRole(c, group, model.RoleAdmin)
+	}
+	return checkRole(c, group, model.RoleOwner)
+}
+
+// @Summary      Adds a user to a group
+// @Accept       json
+// @Param        id      path      string         true  "Group ID"
+// @Param        member  body      MemberRequest  true  "The user to add"
+// @Success      200  {object}  model.Group
+// @Router       /groups/{id}/members [post]
+func (api *Api) PostGroupMember(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	before, err := api.groupWithRole(c, groupId, model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var member MemberRequest
+	err = c.BodyParser(&member)
+	if err != nil {
+		return err
+	}
+	if _, err := api.users.Get(c.Context(), member.User); err != nil {
+		return fmt.Errorf(`%w: field "user" must be a valid user`, fiber.ErrBadRequest)
+	}
+
+	var group model.Group
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.groups.AddMember(ctx, groupId, member.User); err != nil {
+			return notFound(err, "group")
+		}
+		group, err = api.groups.Get(ctx, groupId)
+		if err != nil {
+			return notFound(err, "group")
+		}
+		return api.recordGroup(ctx, c, model.ActionUpdate, &before, &group)
+	})
+	if err != nil {
+		return err
+	}
+
+	setETag(c, group.Version)
+	return c.JSON(group)
+}
+
+// @Summary      Removes a user from a group, or leaves it when removing yourself
+// @Description  The balance of the user in the group must be settled. Users appearing in transactions are kept as former users.
+// @Description  Admins can remove members, only owners can remove admins and owners.
+// @Param        id      path      string  true  "Group ID"
+// @Param        userId  path      string  true  "User ID"
+// @Success      200  {object}  model.Group
+// @Router       /groups/{id}/members/{userId} [delete]
+func (api *Api) DeleteGroupMember(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	userId, err := getId(c.Params("userId"))
+	if err != nil {
+		return err
+	}
+
+	group, err := api.groupWithRole(c, groupId, model.RoleMember)
+	if err != nil {
+		return err
+	}
+	if !group.HasMember(userId) {
+		return fiber.NewError(fiber.StatusNotFound, "user is not a member of this group")
+	}
+	if err := checkRemovalRole(c, &group, userId); err != nil {
+		return err
+	}
+
+	if group.RoleOf(userId) == model.RoleOwner {
+		owners := 0
+		for _, member := range group.Users {
+			if group.RoleOf(member) == model.RoleOwner {
+				owners++
+			}
+		}
+		if owners == 1 {
+			return fiber.NewError(fiber.StatusConflict, "the last owner of a group can not leave it")
+		}
+	}
+
+	keepAsFormer, err := api.checkMemberRemoval(c.Context(), &group, userId)
+	if err != nil {
+		return err
+	}
+	var after model.Group
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.groups.RemoveMember(ctx, groupId, userId, keepAsFormer); err != nil {
+			return notFound(err, "group")
+		}
+		after, err = api.groups.Get(ctx, groupId)
+		if err != nil {
+			return notFound(err, "group")
+		}
+		return api.recordGroup(ctx, c, model.ActionUpdate, &group, &after)
+	})
+	if err != nil {
+		return err
+	}
+	group = after
+
+	setETag(c, group.Version)
+	return c.JSON(group)
+}
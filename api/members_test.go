@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRemoveMemberRoles(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+	dan := a.signup("dan")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{
+		Name:  "trip",
+		Users: []primitive.ObjectID{ann.User.Id, bob.User.Id, carol.User.Id, dan.User.Id},
+	}, &group)
+	path := "/groups/" + group.Id.Hex()
+	a.mustDo(fiber.StatusOK, "PATCH", path, ann.Token, map[string]any{"roles": []model.GroupRole{
+		{User: ann.User.Id, Role: model.RoleOwner},
+		{User: bob.User.Id, Role: model.RoleOwner},
+		{User: carol.User.Id, Role: model.RoleAdmin},
+	}}, &group, fiber.HeaderIfMatch, etag(group.Version))
+
+	// admins can not remove owners, neither one at a time nor by updating the group
+	a.mustDo(fiber.StatusForbidden, "DELETE", path+"/members/"+bob.User.Id.Hex(), carol.Token, nil, nil)
+	a.mustDo(fiber.StatusForbidden, "PATCH", path, carol.Token, map[string]any{
+		"users": []primitive.ObjectID{ann.User.Id, carol.User.Id, dan.User.Id},
+	}, nil, fiber.HeaderIfMatch, etag(group.Version))
+	// members can not remove anyone
+	a.mustDo(fiber.StatusForbidden, "DELETE", path+"/members/"+carol.User.Id.Hex(), dan.Token, nil, nil)
+
+	a.mustDo(fiber.StatusOK, "DELETE", path+"/members/"+dan.User.Id.Hex(), carol.Token, nil, nil)
+	a.mustDo(fiber.StatusOK, "DELETE", path+"/members/"+carol.User.Id.Hex(), bob.Token, nil, nil)
+	a.mustDo(fiber.StatusOK, "DELETE", path+"/members/"+ann.User.Id.Hex(), bob.Token, nil, &group)
+	if len(group.Users) != 1 || group.Users[0] != bob.User.Id {
+		t.Errorf("users = %v, want only bob", group.Users)
+	}
+}
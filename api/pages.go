@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+)
+
+// Page is the envelope of paginated lists
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// NextCursor is sent as the "after" query parameter to get the next page, it is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// pageCursor is encoded in NextCursor, it remembers the sort it was made for
+type pageCursor struct {
+	Sort   string       `bson:"sort"`
+	Cursor store.Cursor `bson:"cursor"`
+}
+
+// sortQuery returns the "sort" query parameter selecting the order of page
+func sortQuery(page store.Page) string {
+	if page.Descending {
+		return "-" + page.Sort
+	}
+	return page.Sort
+}
+
+// pageQuery reads the "sort", "after" and "limit" query parameters.
+// sort must be one of the given fields, prefixed by "-" for a descending order.
+func pageQuery(c *fiber.Ctx, defaultSort string, fields ...string) (store.Page, error) {
+	sort := c.Query("sort", defaultSort)
+	page := store.Page{
+		Sort:       strings.TrimPrefix(sort, "-"),
+		Descending: strings.HasPrefix(sort, "-"),
+	}
+	valid := false
+	for _, field := range fields {
+		valid = valid || page.Sort == field
+	}
+	if !valid {
+		return page, fmt.Errorf(`%w: query "sort" must be one of "%s", prefixed by "-" for a descending order`, fiber.ErrBadRequest, strings.Join(fields, `", "`))
+	}
+
+	limit, err := limitQuery(c)
+	if err != nil {
+		return page, err
+	}
+	// one more document tells whether there is a next page, see newPage
+	page.Limit = limit + 1
+
+	if after := c.Query("after"); after != "" {
+		var cursor pageCursor
+		raw, err := base64.RawURLEncoding.DecodeString(after)
+		if err == nil {
+			err = bson.Unmarshal(raw, &cursor)
+		}
+		if err != nil || cursor.Sort != sort {
+			return page, fiber.NewError(fiber.StatusBadRequest, `query "after" must be the cursor of a page with the same sort`)
+		}
+		page.After = &cursor.Cursor
+	}
+
+	return page, nil
+}
+
+// limitQuery reads the "limit" query parameter
+func limitQuery(c *fiber.Ctx) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf(`%w: query "limit" must be a number between 1 and %d`, fiber.ErrBadRequest, maxPageLimit)
+	}
+	return limit, nil
+}
+
+// newPage returns the envelope of docs, listed with a page returned by pageQuery
+func newPage[T any](docs []T, page store.Page, cursorOf func(*T, string) store.Cursor) (Page[T], error) {
+	if len(docs) < page.Limit {
+		return Page[T]{Items: docs}, nil
+	}
+
+	docs = docs[:page.Limit-1]
+	raw, err := bson.Marshal(pageCursor{
+		Sort:   sortQuery(page),
+		Cursor: cursorOf(&docs[len(docs)-1], page.Sort),
+	})
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return Page[T]{Items: docs, NextCursor: base64.RawURLEncoding.EncodeToString(raw)}, nil
+}
+
+// queryId reads an optional id from the query parameters
+func queryId(c *fiber.Ctx, name string) (primitive.ObjectID, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return primitive.NilObjectID, nil
+	}
+	id, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		return id, fmt.Errorf(`%w: query "%s" must be a valid id`, fiber.ErrBadRequest, name)
+	}
+	return id, nil
+}
+
+// queryDate reads an optional date from the query parameters, either as RFC 3339 or as YYYY-MM-DD
+func queryDate(c *fiber.Ctx, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if date, err := time.Parse(layout, raw); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`%w: query "%s" must be a RFC 3339 date or a YYYY-MM-DD day`, fiber.ErrBadRequest, name)
+}
+
+// queryAmount reads an optional amount from the query parameters
+func queryAmount(c *fiber.Ctx, name string) (uint32, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf(`%w: query "%s" must be a positive amount`, fiber.ErrBadRequest, name)
+	}
+	return uint32(amount), nil
+}
+
+// queryBool reads an optional boolean from the query parameters, false when missing
+func queryBool(c *fiber.Ctx, name string) (bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf(`%w: query "%s" must be true or false`, fiber.ErrBadRequest, name)
+	}
+	return value, nil
+}
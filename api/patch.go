@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mergePatch applies the JSON merge patch (RFC 7396) in the body of the request
+// to the JSON form of doc and returns the result
+func mergePatch[T any](c *fiber.Ctx, doc *T) (T, error) {
+	var merged T
+
+	var patch any
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return merged, fiber.NewError(fiber.StatusBadRequest, "the body must be a JSON merge patch: "+err.Error())
+	}
+	if _, ok := patch.(map[string]any); !ok {
+		return merged, fiber.NewError(fiber.StatusBadRequest, "the body must be a JSON merge patch object")
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return merged, err
+	}
+	var target any
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return merged, err
+	}
+
+	raw, err = json.Marshal(applyMergePatch(target, patch))
+	if err != nil {
+		return merged, err
+	}
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return merged, fiber.NewError(fiber.StatusBadRequest, "the patched document is invalid: "+err.Error())
+	}
+	return merged, nil
+}
+
+// applyMergePatch is the MergePatch function of RFC 7396
+func applyMergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = applyMergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
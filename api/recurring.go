@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxRecurringBackfillYears is how far in the past a recurrence can start, its past occurrences are all created at once
+	maxRecurringBackfillYears = 1
+	// maxOccurrencesPerRun keeps a recurring transaction from holding the scheduler, the next run creates the rest
+	maxOccurrencesPerRun = 100
+)
+
+type SkipRequest struct {
+	// Date is the date of the occurrence to skip
+	Date time.Time `json:"date"`
+}
+
+// memberRecurring loads a recurring transaction from a group the current user is a member of
+func (api *Api) memberRecurring(c *fiber.Ctx, recurringId primitive.ObjectID) (model.RecurringTransaction, model.Group, error) {
+	recurring, err := api.recurring.Get(c.Context(), recurringId)
+	if err != nil {
+		return recurring, model.Group{}, notFound(err, "recurring transaction")
+	}
+	group, err := api.memberGroup(c, recurring.Group)
+	return recurring, group, err
+}
+
+// editedRecurring returns the recurring transaction the request is about with its group if the request has its version
+func (api *Api) editedRecurring(c *fiber.Ctx) (model.RecurringTransaction, model.Group, error) {
+	recurringId, err := getId(c.Params("id"))
+	if err != nil {
+		return model.RecurringTransaction{}, model.Group{}, err
+	}
+
+	stored, group, err := api.memberRecurring(c, recurringId)
+	if err != nil {
+		return stored, group, err
+	}
+	if err := checkIfMatch(c, stored.Version); err != nil {
+		return stored, group, err
+	}
+	return stored, group, nil
+}
+
+// checkRecurring validates a recurring transaction of the group and schedules its next occurrence
+func checkRecurring(group *model.Group, recurring *model.RecurringTransaction) error {
+	recurring.Group = group.Id
+	// the template only keeps what is copied on each occurrence
+	recurring.Template.Id = primitive.NilObjectID
+	recurring.Template.Group = group.Id
+	recurring.Template.Kind = recurring.Template.GetKind()
+	recurring.Template.Date = time.Time{}
+	recurring.Template.DeletedAt = nil
+	recurring.Template.Recurring = nil
+	recurring.Template.Version = 0
+	if err := recurring.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	// the exchange rate and the prices are resolved on each occurrence, the group rates may change in between
+	first := recurring.Occurrence(recurring.Recurrence.Start)
+	if err := first.ResolveExchangeRate(group); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "template: "+err.Error())
+	}
+	if err := checkTransactionMembers(group, &first); err != nil {
+		return err
+	}
+	if err := first.ComputePrices(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "template: "+err.Error())
+	}
+
+	recurring.Schedule()
+	return nil
+}
+
+// checkStart refuses the recurrences starting too long ago, see maxRecurringBackfillYears
+func checkStart(recurrence *model.Recurrence) error {
+	if recurrence.Start.Before(time.Now().AddDate(-maxRecurringBackfillYears, 0, 0)) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf(`field "recurrence.start" must not be more than %d year in the past`, maxRecurringBackfillYears))
+	}
+	return nil
+}
+
+// @Summary      Returns the recurring transactions of a group
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.RecurringTransaction
+// @Router       /groups/{id}/recurring [get]
+func (api *Api) GetGroupRecurringTransactions(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.memberGroup(c, groupId); err != nil {
+		return err
+	}
+
+	recurring, err := api.recurring.List(c.Context(), groupId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(recurring)
+}
+
+// @Summary      Creates a recurring transaction, its template is copied on each occurrence of its recurrence
+// @Accept       json
+// @Param        id   path      string  true  "Group ID"
+// @Param        recurring  body      model.RecurringTransaction  true  "The recurrence and template of the recurring transaction"
+// @Success      200  {object}  model.RecurringTransaction
+// @Router       /groups/{id}/recurring [post]
+func (api *Api) PostGroupRecurringTransaction(c *fiber.Ctx) error {
+	var request model.RecurringTransaction
+	err := c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	recurring := model.RecurringTransaction{
+		Recurrence: request.Recurrence,
+		Template:   request.Template,
+		CreatedBy:  currentUser(c).Id,
+		CreatedAt:  time.Now(),
+		Skipped:    []time.Time{},
+	}
+	if err := checkStart(&recurring.Recurrence); err != nil {
+		return err
+	}
+	if err := checkRecurring(&group, &recurring); err != nil {
+		return err
+	}
+
+	err = api.recurring.Insert(c.Context(), &recurring)
+	if err != nil {
+		return err
+	}
+
+	setETag(c, recurring.Version)
+	return c.JSON(recurring)
+}
+
+// @Summary      Returns a recurring transaction
+// @Param        id   path      string  true  "Recurring transaction ID"
+// @Success      200  {object}  model.RecurringTransaction
+// @Router       /recurring/{id} [get]
+func (api *Api) GetRecurringTransaction(c *fiber.Ctx) error {
+	recurringId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	recurring, _, err := api.memberRecurring(c, recurringId)
+	if err != nil {
+		return err
+	}
+
+	setETag(c, recurring.Version)
+	return c.JSON(recurring)
+}
+
+// @Summary      Updates the recurrence and template of a recurring transaction
+// @Description  Transactions already created are kept, the next occurrences follow the new recurrence and template.
+// @Accept       json
+// @Param        id   path      string  true  "Recurring transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the recurring transaction"
+// @Param        recurring  body      model.RecurringTransaction  true  "The recurrence and template of the recurring transaction"
+// @Success      200  {object}  model.RecurringTransaction
+// @Router       /recurring/{id} [put]
+func (api *Api) PutRecurringTransaction(c *fiber.Ctx) error {
+	stored, group, err := api.editedRecurring(c)
+	if err != nil {
+		return err
+	}
+
+	var request model.RecurringTransaction
+	err = c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+
+	// recurrences that started long ago can still be edited, as long as their start stays
+	if !request.Recurrence.Start.Equal(stored.Recurrence.Start) {
+		if err := checkStart(&request.Recurrence); err != nil {
+			return err
+		}
+	}
+	recurring := stored
+	recurring.Recurrence = request.Recurrence
+	recurring.Template = request.Template
+	if err := checkRecurring(&group, &recurring); err != nil {
+		return err
+	}
+
+	err = api.recurring.Replace(c.Context(), &recurring)
+	if err != nil {
+		return versionConflict(err, "recurring transaction")
+	}
+
+	setETag(c, recurring.Version)
+	return c.JSON(recurring)
+}
+
+// @Summary      Deletes a recurring transaction, the transactions it created are kept
+// @Param        id   path      string  true  "Recurring transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the recurring transaction"
+// @Success      204
+// @Router       /recurring/{id} [delete]
+func (api *Api) DeleteRecurringTransaction(c *fiber.Ctx) error {
+	recurring, _, err := api.editedRecurring(c)
+	if err != nil {
+		return err
+	}
+
+	err = api.recurring.Delete(c.Context(), recurring.Id)
+	if err != nil {
+		return err
+	}
+
+	c.Status(fiber.StatusNoContent)
+	return nil
+}
+
+// @Summary      Skips an occurrence of a recurring transaction, no transaction is created on its date
+// @Accept       json
+// @Param        id   path      string  true  "Recurring transaction ID"
+// @Param        skip  body      SkipRequest  true  "The occurrence to skip"
+// @Success      200  {object}  model.RecurringTransaction
+// @Router       /recurring/{id}/skip [post]
+func (api *Api) SkipRecurringOccurrence(c *fiber.Ctx) error {
+	recurringId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	recurring, _, err := api.memberRecurring(c, recurringId)
+	if err != nil {
+		return err
+	}
+
+	var request SkipRequest
+	err = c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	if !recurring.IsOccurrence(request.Date) {
+		return fiber.NewError(fiber.StatusBadRequest, `field "date" must be the date of an occurrence`)
+	}
+	if recurring.Last != nil && !request.Date.After(*recurring.Last) {
+		return fiber.NewError(fiber.StatusConflict, "the transaction of this occurrence was already created")
+	}
+
+	if !recurring.IsSkipped(request.Date) {
+		recurring.Skipped = append(recurring.Skipped, request.Date)
+		recurring.Schedule()
+		err = api.recurring.Replace(c.Context(), &recurring)
+		if err != nil {
+			return versionConflict(err, "recurring transaction")
+		}
+	}
+
+	setETag(c, recurring.Version)
+	return c.JSON(recurring)
+}
+
+// CreateDueOccurrences creates the transactions of the occurrences of recurring transactions due at the given time.
+// A recurring transaction that fails is logged and retried on the next call, without blocking the others.
+func (api *Api) CreateDueOccurrences(ctx context.Context, now time.Time) error {
+	due, err := api.recurring.ListDue(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, recurring := range due {
+		if err := api.createOccurrences(ctx, recurring, now); err != nil {
+			log.Printf("could not create the occurrences of recurring transaction %s: %v", recurring.Id.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// createOccurrences creates the transactions of the occurrences of a recurring transaction due at the given time
+func (api *Api) createOccurrences(ctx context.Context, recurring model.RecurringTransaction, now time.Time) error {
+	group, err := api.groups.Get(ctx, recurring.Group)
+	if err != nil {
+		return err
+	}
+	// the missed occurrences are created once the group is restored
+	if group.DeletedAt != nil {
+		return nil
+	}
+
+	for created := 0; recurring.NextDate != nil && !recurring.NextDate.After(now); created++ {
+		if created == maxOccurrencesPerRun {
+			log.Printf("recurring transaction %s has more than %d due occurrences, the next run creates the rest", recurring.Id.Hex(), maxOccurrencesPerRun)
+			return nil
+		}
+		date := *recurring.NextDate
+		err := api.withTransaction(ctx, func(ctx context.Context) error {
+			if err := api.createOccurrence(ctx, &group, &recurring, date); err != nil {
+				return err
+			}
+			recurring.Last = &date
+			recurring.Schedule()
+			// fails when the recurring transaction changed, it is then retried with its new version
+			return api.recurring.Replace(ctx, &recurring)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createOccurrence creates the transaction of the occurrence of the given date, unless it already exists
+func (api *Api) createOccurrence(ctx context.Context, group *model.Group, recurring *model.RecurringTransaction, date time.Time) error {
+	// dates are stored with a millisecond precision, an occurrence deleted by a user stays deleted
+	existing, err := api.transactions.List(ctx, store.TransactionFilter{
+		Recurring: recurring.Id,
+		Deletion:  store.AnyDeletion,
+		DateFrom:  date,
+		DateTo:    date.Add(time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing) != 0 {
+		return nil
+	}
+
+	transaction := recurring.Occurrence(date)
+	if err := transaction.ResolveExchangeRate(group); err != nil {
+		return err
+	}
+	if err := checkTransactionMembers(group, &transaction); err != nil {
+		return err
+	}
+	if err := transaction.ComputePrices(); err != nil {
+		return err
+	}
+	if err := api.transactions.Insert(ctx, &transaction); err != nil {
+		return err
+	}
+	return api.recordBy(ctx, recurring.CreatedBy, model.EntityTransaction, transaction.Id, transaction.Group, model.ActionCreate, nil, &transaction)
+}
+
+// RunRecurringTransactions creates the due occurrences of recurring transactions every interval, until ctx is done
+func (api *Api) RunRecurringTransactions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.CreateDueOccurrences(ctx, time.Now()); err != nil {
+			log.Printf("could not create the recurring transactions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
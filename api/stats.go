@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// biggestExpenses is the number of expenses listed in the group stats
+const biggestExpenses = 5
+
+// @Summary      Returns statistics on the expenses of the group, in the group currency
+// @Description  Transfers between members are not expenses and are left out
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  model.GroupStats
+// @Router       /groups/{id}/stats [get]
+func (api *Api) GetGroupStats(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
+	}
+
+	stats, err := api.transactions.Stats(c.Context(), groupId, biggestExpenses)
+	if err != nil {
+		return err
+	}
+	if len(group.Users) != 0 {
+		stats.AveragePerPerson = stats.Total / int64(len(group.Users))
+	}
+
+	return c.JSON(stats)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGroupStatsAveragePerPerson(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id, carol.User.Id}}, &group)
+	for _, kind := range []string{"expense", "transfer"} {
+		a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, map[string]any{
+			"kind":     kind,
+			"paidBy":   ann.User.Id,
+			"paidFor":  []map[string]any{{"user": bob.User.Id, "weight": 1}},
+			"amount":   1001,
+			"date":     "2024-01-01T00:00:00Z",
+			"category": "food",
+		}, nil)
+	}
+
+	// the transfer is not an expense, the average is rounded down
+	var stats model.GroupStats
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/stats", bob.Token, nil, &stats)
+	if stats.Total != 1001 || stats.AveragePerPerson != 333 {
+		t.Errorf("total = %d and average per person = %d, want 1001 and 333", stats.Total, stats.AveragePerPerson)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+// recentTransactions is the number of transactions listed in a user summary
+const recentTransactions = 10
+
+// @Summary      Returns the position of the user in every group they belong to
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  model.UserSummary
+// @Router       /users/{id}/summary [get]
+func (api *Api) GetUserSummary(c *fiber.Ctx) error {
+	userId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if userId != currentUser(c).Id {
+		return fiber.NewError(fiber.StatusForbidden, "users can only see their own summary")
+	}
+
+	groups, err := api.groups.List(c.Context(), store.GroupFilter{User: userId})
+	if err != nil {
+		return err
+	}
+	// transactions not involving the user do not change their balance
+	transactions, err := api.transactions.List(c.Context(), store.TransactionFilter{User: userId})
+	if err != nil {
+		return err
+	}
+
+	summary, err := model.Summarize(userId, groups, transactions, recentTransactions)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(summary)
+}
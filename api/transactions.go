@@ -1,37 +1,114 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/triplan-planning/api-go/model"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// @Summary      Returns all the spending from this trip
+// @Summary      Returns the spending from this trip, newest first unless sorted otherwise
 // @Accept       json
-// @Param        id   path      string  true  "Group ID"
-// @Success      200  {object}  model.Transaction
+// @Param        id           path      string  true  "Group ID"
+// @Param        kind         query     string  false "Only return transactions of this kind" Enums(expense, transfer)
+// @Param        category     query     string  false "Only return transactions of this category"
+// @Param        paidBy       query     string  false "Only return transactions paid by this user"
+// @Param        participant  query     string  false "Only return transactions paid for this user"
+// @Param        dateFrom     query     string  false "Only return transactions dated from this day or time"
+// @Param        dateTo       query     string  false "Only return transactions dated before this day or time"
+// @Param        amountMin    query     int     false "Only return transactions of at least this amount"
+// @Param        amountMax    query     int     false "Only return transactions of at most this amount"
+// @Param        sort         query     string  false "Sort field, prefixed by - for a descending order" Enums(created, -created, date, -date, amount, -amount)
+// @Param        limit        query     int     false "Maximum number of transactions returned, 100 by default"
+// @Param        after        query     string  false "Cursor of the previous page"
+// @Success      200  {object}  Page[model.Transaction]
 // @Router       /groups/{id}/transactions [get]
 func (api *Api) GetGroupTransactions(c *fiber.Ctx) error {
 	tripId, err := getId(c.Params("id"))
 	if err != nil {
 		return err
 	}
-	res, err := api.transactionsColl.Find(c.Context(), model.Transaction{Group: tripId}, options.Find().SetSort(bson.M{"_id": -1}))
+	if _, err := api.memberGroup(c, tripId); err != nil {
+		return err
+	}
+
+	filter := store.TransactionFilter{
+		Group:    tripId,
+		Kind:     model.TransactionKind(c.Query("kind")),
+		Category: c.Query("category"),
+	}
+	if filter.PaidBy, err = queryId(c, "paidBy"); err != nil {
+		return err
+	}
+	if filter.Participant, err = queryId(c, "participant"); err != nil {
+		return err
+	}
+	if filter.DateFrom, err = queryDate(c, "dateFrom"); err != nil {
+		return err
+	}
+	if filter.DateTo, err = queryDate(c, "dateTo"); err != nil {
+		return err
+	}
+	if filter.AmountMin, err = queryAmount(c, "amountMin"); err != nil {
+		return err
+	}
+	if filter.AmountMax, err = queryAmount(c, "amountMax"); err != nil {
+		return err
+	}
+	filter.Page, err = pageQuery(c, "-"+store.SortCreated, store.SortCreated, store.SortDate, store.SortAmount)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := api.transactions.List(c.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	response, err := newPage(transactions, filter.Page, store.TransactionCursor)
+	if err != nil {
+		return err
+	}
+	return c.JSON(response)
+}
+
+// @Summary      Searches the words of q in the title and category of the transactions of a trip, best matches first
+// @Description  Words prefixed by "-" exclude the transactions containing them
+// @Param        id     path      string  true  "Group ID"
+// @Param        q      query     string  true  "Words to search"
+// @Param        limit  query     int     false "Maximum number of transactions returned, 100 by default"
+// @Success      200  {object}  Page[model.TransactionMatch]
+// @Router       /groups/{id}/transactions/search [get]
+func (api *Api) SearchGroupTransactions(c *fiber.Ctx) error {
+	tripId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.memberGroup(c, tripId); err != nil {
+		return err
+	}
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		return fiber.NewError(fiber.StatusBadRequest, `query "q" must be non-empty`)
+	}
+	limit, err := limitQuery(c)
 	if err != nil {
 		return err
 	}
 
-	var transactions []model.Transaction
-	err = res.All(c.Context(), &transactions)
+	matches, err := api.transactions.Search(c.Context(), tripId, text, limit)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(transactions)
+	// results are ranked, they have no next page
+	return c.JSON(Page[model.TransactionMatch]{Items: matches})
 }
 
 // @Summary      Returns a transaction
@@ -44,28 +121,39 @@ func (api *Api) GetTransaction(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	var transaction model.Transaction
-
-	filter := bson.M{"_id": transactionId}
-	err = api.transactionsColl.FindOne(
-		c.Context(),
-		filter,
-	).Decode(
-		&transaction,
-	)
 
+	transaction, _, err := api.memberTransaction(c, transactionId)
 	if err != nil {
 		return err
 	}
 
+	setETag(c, transaction.Version)
 	return c.JSON(transaction)
 }
 
+// checkTransactionMembers validates that all users on the transaction are members of the group
+func checkTransactionMembers(group *model.Group, transaction *model.Transaction) error {
+	// use a map for easier/faster access
+	groupUsersMap := map[primitive.ObjectID]bool{}
+	for _, userId := range group.Users {
+		groupUsersMap[userId] = true
+	}
+	if _, ok := groupUsersMap[transaction.PaidBy]; !ok {
+		return fmt.Errorf(` %w: the payer must be a member of the group`, fiber.ErrBadRequest)
+	}
+	for _, userId := range transaction.Users() {
+		if _, ok := groupUsersMap[userId]; !ok {
+			return fmt.Errorf(` %w: field 'users' must be a list of valid group members`, fiber.ErrBadRequest)
+		}
+	}
+	return nil
+}
+
 // @Summary      Creates a transaction
 // @Accept       json
 // @Param        id   path      string  true  "Group ID"
 // @Param        transaction  body      model.Transaction  true  "The transaction to create"
-// @Success      200  {object}  model.Transaction
+// @Success      200  {object}  PostTransactionResponse
 // @Router       /groups/{id}/transactions [post]
 func (api *Api) PostGroupTransaction(c *fiber.Ctx) error {
 	var transaction model.Transaction
@@ -79,55 +167,61 @@ func (api *Api) PostGroupTransaction(c *fiber.Ctx) error {
 	}
 
 	// get group from DB
-	groupRes := api.groupsColl.FindOne(c.Context(), bson.M{"_id": groupId})
-	if groupRes.Err() != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid group id")
+	group, err := api.memberGroup(c, groupId)
+	if err != nil {
+		return err
 	}
 	// force the group id on the transaction if the group exists
 	transaction.Group = groupId
+	// only the scheduler creates occurrences of recurring transactions
+	transaction.Recurring = nil
 
 	if err := transaction.Validate(); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
-
-	// validate that all users on the transaction are members of the group
-	var group model.Group
-	err = groupRes.Decode(&group)
-	if err != nil {
-		return err
+	transaction.Kind = transaction.GetKind()
+	transaction.DeletedAt = nil
+	if err := transaction.ResolveExchangeRate(&group); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	// use a map for easier/faster access
-	groupUsersMap := map[primitive.ObjectID]bool{}
-	for _, userId := range group.Users {
-		groupUsersMap[userId] = true
-	}
-	if _, ok := groupUsersMap[transaction.PaidBy]; !ok {
-		return fmt.Errorf(` %w: the payer must be a member of the group`, fiber.ErrBadRequest)
-	}
-	for _, userId := range transaction.Users() {
-		if _, ok := groupUsersMap[userId]; !ok {
-			return fmt.Errorf(` %w: field 'users' must be a list of valid group members`, fiber.ErrBadRequest)
-		}
+	if err := checkTransactionMembers(&group, &transaction); err != nil {
+		return err
 	}
 
-	transaction.Id = primitive.NilObjectID
 	err = transaction.ComputePrices()
 	if err != nil {
-		return err
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	res, err := api.transactionsColl.InsertOne(c.Context(), transaction)
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.transactions.Insert(ctx, &transaction); err != nil {
+			return err
+		}
+		return api.recordTransaction(ctx, c, model.ActionCreate, nil, &transaction)
+	})
 	if err != nil {
 		return err
 	}
-	transaction.Id = res.InsertedID.(primitive.ObjectID)
 
-	return c.JSON(transaction)
+	response := PostTransactionResponse{Transaction: transaction}
+	if group.Budget != nil {
+		report, err := api.budgetReport(c.Context(), &group)
+		if err != nil {
+			return err
+		}
+		if exceeded, ok := report.Exceeded(&transaction); ok {
+			response.OverBudget = &exceeded
+		}
+	}
+
+	setETag(c, transaction.Version)
+	return c.JSON(response)
 }
 
-// @Summary      Deletes a transaction
+// @Summary      Moves a transaction to the trash
 // @Param        id   path      string  true  "Transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the transaction"
 // @Success      204
 // @Router       /transactions/{id} [delete]
 func (api *Api) DeleteTransaction(c *fiber.Ctx) error {
@@ -135,11 +229,25 @@ func (api *Api) DeleteTransaction(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	transaction, _, err := api.memberTransaction(c, tripId)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, transaction.Version); err != nil {
+		return err
+	}
 
-	_, err = api.transactionsColl.DeleteOne(c.Context(), bson.M{
-		"_id": tripId,
+	// the transaction goes to the trash, see PurgeTrash
+	now := time.Now()
+	deleted := transaction
+	deleted.DeletedAt = &now
+	deleted.Version++
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.transactions.SetDeletedAt(ctx, tripId, transaction.Version, &now); err != nil {
+			return versionConflict(err, "transaction")
+		}
+		return api.recordTransaction(ctx, c, model.ActionDelete, &transaction, &deleted)
 	})
-
 	if err != nil {
 		return err
 	}
@@ -148,56 +256,113 @@ func (api *Api) DeleteTransaction(c *fiber.Ctx) error {
 	return nil
 }
 
-// @Summary      Updates a transaction
-// @Accept       json
-// @Param        id   path      string  true  "Transaction ID"
-// @Param        transaction  body      model.Transaction  true  "The transaction to update"
-// @Success      200  {object}  model.Transaction
-// @Router       /transactions/{id} [put]
-func (api *Api) PutTransaction(c *fiber.Ctx) error {
+// editedTransaction returns the transaction the request is about with its group if the request has its version
+func (api *Api) editedTransaction(c *fiber.Ctx) (model.Transaction, model.Group, error) {
 	spendingId, err := getId(c.Params("id"))
 	if err != nil {
-		return err
+		return model.Transaction{}, model.Group{}, err
 	}
 
-	var transaction model.Transaction
-	err = c.BodyParser(&transaction)
+	stored, group, err := api.memberTransaction(c, spendingId)
 	if err != nil {
-		return err
+		return stored, group, err
 	}
+	if err := checkIfMatch(c, stored.Version); err != nil {
+		return stored, group, err
+	}
+	return stored, group, nil
+}
+
+// updateTransaction validates transaction, computes its prices and replaces the stored transaction with it
+func (api *Api) updateTransaction(c *fiber.Ctx, stored model.Transaction, group model.Group, transaction model.Transaction) error {
+	// transactions can not be moved to another group, nor to another recurring transaction
+	transaction.Group = stored.Group
+	transaction.Recurring = stored.Recurring
+
 	if err := transaction.Validate(); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
+	transaction.Kind = transaction.GetKind()
+	transaction.DeletedAt = nil
+	if err := transaction.ResolveExchangeRate(&group); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := checkTransactionMembers(&group, &transaction); err != nil {
+		return err
+	}
+
+	transaction.Id = stored.Id
+	transaction.Version = stored.Version
 
-	users := transaction.Users()
+	err := transaction.ComputePrices()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
 
-	cnt, err := api.usersColl.CountDocuments(c.Context(), bson.M{
-		"_id": bson.M{"$in": users},
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		// a retried transaction replaces the stored version again
+		transaction.Version = stored.Version
+		if err := api.transactions.Replace(ctx, &transaction); err != nil {
+			return versionConflict(err, "transaction")
+		}
+		return api.recordTransaction(ctx, c, model.ActionUpdate, &stored, &transaction)
 	})
 	if err != nil {
 		return err
 	}
-	if cnt != int64(len(users)) {
-		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf(`field "users" must be a list of valid users: got %d valid users out of %d`, cnt, len(users)))
+
+	setETag(c, transaction.Version)
+	return c.JSON(transaction)
+}
+
+// @Summary      Updates a transaction
+// @Accept       json
+// @Param        id   path      string  true  "Transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the transaction"
+// @Param        transaction  body      model.Transaction  true  "The transaction to update"
+// @Success      200  {object}  model.Transaction
+// @Router       /transactions/{id} [put]
+func (api *Api) PutTransaction(c *fiber.Ctx) error {
+	stored, group, err := api.editedTransaction(c)
+	if err != nil {
+		return err
 	}
 
-	transaction.Id = spendingId
+	var transaction model.Transaction
+	err = c.BodyParser(&transaction)
 	if err != nil {
 		return err
 	}
 
-	err = transaction.ComputePrices()
+	return api.updateTransaction(c, stored, group, transaction)
+}
+
+// @Summary      Updates some fields of a transaction
+// @Description  Fields missing from the patch are kept, fields set to null are removed. Prices are computed again.
+// @Accept       json
+// @Param        id   path      string  true  "Transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the transaction"
+// @Param        patch  body      object  true  "JSON merge patch (RFC 7396) of the transaction"
+// @Success      200  {object}  model.Transaction
+// @Router       /transactions/{id} [patch]
+func (api *Api) PatchTransaction(c *fiber.Ctx) error {
+	stored, group, err := api.editedTransaction(c)
 	if err != nil {
 		return err
 	}
 
-	res, err := api.transactionsColl.ReplaceOne(c.Context(), bson.M{"_id": transaction.Id}, transaction)
+	transaction, err := mergePatch(c, &stored)
 	if err != nil {
 		return err
 	}
-	if res.ModifiedCount != 1 {
-		return fmt.Errorf("could not update spending")
+	// the stored rate is the one of the stored currency, a new currency gets the rate of the group unless the patch has one
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &fields); err != nil {
+		return err
+	}
+	if _, ok := fields["exchangeRate"]; !ok && transaction.Currency != stored.Currency {
+		transaction.ExchangeRate = 0
 	}
 
-	return c.JSON(transaction)
+	return api.updateTransaction(c, stored, group, transaction)
 }
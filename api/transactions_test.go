@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPatchTransactionCurrency(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{
+		Name:          "trip",
+		Users:         []primitive.ObjectID{ann.User.Id, bob.User.Id},
+		Currency:      "EUR",
+		ExchangeRates: map[string]float64{"USD": 0.5, "GBP": 2},
+	}, &group)
+	var transaction model.Transaction
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, map[string]any{
+		"paidBy":   ann.User.Id,
+		"paidFor":  []map[string]any{{"user": bob.User.Id, "weight": 1}},
+		"amount":   1000,
+		"currency": "USD",
+		"date":     "2024-01-01T00:00:00Z",
+		"category": "food",
+	}, &transaction)
+	if transaction.ExchangeRate != 0.5 {
+		t.Fatalf("exchange rate = %v, want 0.5", transaction.ExchangeRate)
+	}
+
+	tests := []struct {
+		name    string
+		patch   map[string]any
+		rate    float64
+		balance int32
+	}{
+		{"a new currency gets the rate of the group", map[string]any{"currency": "GBP"}, 2, 2000},
+		{"the group currency has no rate", map[string]any{"currency": "EUR"}, 1, 1000},
+		{"a rate in the patch is kept", map[string]any{"currency": "USD", "exchangeRate": 0.25}, 0.25, 250},
+		{"the rate is kept when the currency is", map[string]any{"amount": 2000}, 0.25, 500},
+	}
+	for _, test := range tests {
+		a.mustDo(fiber.StatusOK, "PATCH", "/transactions/"+transaction.Id.Hex(), ann.Token, test.patch, &transaction, fiber.HeaderIfMatch, etag(transaction.Version))
+		if transaction.ExchangeRate != test.rate {
+			t.Errorf("%s: exchange rate = %v, want %v", test.name, transaction.ExchangeRate, test.rate)
+		}
+		var balances map[string]model.Balance
+		a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/balances", ann.Token, nil, &balances)
+		if got := balances[ann.User.Id.Hex()].TotalAmount; got != test.balance {
+			t.Errorf("%s: balance of ann = %d, want %d", test.name, got, test.balance)
+		}
+	}
+}
+
+func TestTrashVersions(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id}}, &group)
+	var transaction model.Transaction
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, map[string]any{
+		"paidBy":   ann.User.Id,
+		"paidFor":  []map[string]any{{"user": ann.User.Id, "weight": 1}},
+		"amount":   1000,
+		"date":     "2024-01-01T00:00:00Z",
+		"category": "food",
+	}, &transaction)
+	read := transaction
+	path := "/transactions/" + transaction.Id.Hex()
+	a.mustDo(fiber.StatusOK, "PATCH", path, ann.Token, map[string]any{"amount": 2000}, &transaction, fiber.HeaderIfMatch, etag(transaction.Version))
+
+	// the transaction changed since it was read
+	a.mustDo(fiber.StatusPreconditionFailed, "DELETE", path, ann.Token, nil, nil, fiber.HeaderIfMatch, etag(read.Version))
+	a.mustDo(fiber.StatusNoContent, "DELETE", path, ann.Token, nil, nil, fiber.HeaderIfMatch, etag(transaction.Version))
+	a.mustDo(fiber.StatusPreconditionRequired, "POST", path+"/restore", ann.Token, nil, nil)
+	a.mustDo(fiber.StatusPreconditionFailed, "POST", path+"/restore", ann.Token, nil, nil, fiber.HeaderIfMatch, etag(transaction.Version))
+	a.mustDo(fiber.StatusOK, "POST", path+"/restore", ann.Token, nil, &transaction, fiber.HeaderIfMatch, etag(transaction.Version+1))
+	if transaction.DeletedAt != nil || transaction.Version != 4 {
+		t.Errorf("restored transaction = %+v, want version 4 out of the trash", transaction)
+	}
+
+	groupPath := "/groups/" + group.Id.Hex()
+	a.mustDo(fiber.StatusNoContent, "DELETE", groupPath, ann.Token, nil, nil, fiber.HeaderIfMatch, etag(group.Version))
+	a.mustDo(fiber.StatusPreconditionFailed, "POST", groupPath+"/restore", ann.Token, nil, nil, fiber.HeaderIfMatch, etag(group.Version))
+	a.mustDo(fiber.StatusOK, "POST", groupPath+"/restore", ann.Token, nil, &group, fiber.HeaderIfMatch, etag(group.Version+1))
+}
+
+// failingHistory is a history whose inserts fail
+type failingHistory struct {
+	store.HistoryStore
+}
+
+func (failingHistory) Insert(ctx context.Context, entry *model.HistoryEntry) error {
+	return errors.New("history is down")
+}
+
+func TestHistoryFailureRollsBack(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id, carol.User.Id}}, &group)
+	body := map[string]any{
+		"paidBy":   ann.User.Id,
+		"paidFor":  []map[string]any{{"user": bob.User.Id, "weight": 1}},
+		"amount":   1000,
+		"date":     "2024-01-01T00:00:00Z",
+		"category": "food",
+	}
+	var transaction model.Transaction
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, body, &transaction)
+
+	history := a.api.history
+	a.api.history = failingHistory{history}
+	path := "/transactions/" + transaction.Id.Hex()
+	a.mustDo(fiber.StatusInternalServerError, "POST", "/groups/"+group.Id.Hex()+"/transactions", ann.Token, body, nil)
+	a.mustDo(fiber.StatusInternalServerError, "PATCH", path, ann.Token, map[string]any{"amount": 2000}, nil, fiber.HeaderIfMatch, etag(transaction.Version))
+	a.mustDo(fiber.StatusInternalServerError, "DELETE", path, ann.Token, nil, nil, fiber.HeaderIfMatch, etag(transaction.Version))
+	a.mustDo(fiber.StatusInternalServerError, "DELETE", "/groups/"+group.Id.Hex()+"/members/"+carol.User.Id.Hex(), ann.Token, nil, nil)
+	a.api.history = history
+
+	// none of the failed writes were kept
+	var balances map[string]model.Balance
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/balances", ann.Token, nil, &balances)
+	if got := balances[ann.User.Id.Hex()].TotalAmount; got != 1000 {
+		t.Errorf("balance of ann = %d, want 1000", got)
+	}
+	var users []model.User
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/users", ann.Token, nil, &users)
+	if len(users) != 3 {
+		t.Errorf("group has %d users, want 3", len(users))
+	}
+	a.mustDo(fiber.StatusOK, "PATCH", path, ann.Token, map[string]any{"amount": 2000}, &transaction, fiber.HeaderIfMatch, etag(transaction.Version))
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+)
+
+// @Summary      Returns the groups of the current user that are in the trash
+// @Success      200  {array}   model.Group
+// @Router       /groups/trash [get]
+func (api *Api) GetTrashedGroups(c *fiber.Ctx) error {
+	groups, err := api.groups.List(c.Context(), store.GroupFilter{
+		User:     currentUser(c).Id,
+		Deletion: store.Deleted,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(groups)
+}
+
+// @Summary      Restores a group from the trash
+// @Param        id   path      string  true  "Group ID"
+// @Param        If-Match  header  string  true  "ETag of the group"
+// @Success      200  {object}  model.Group
+// @Router       /groups/{id}/restore [post]
+func (api *Api) RestoreGroup(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	group, err := api.groups.Get(c.Context(), groupId)
+	if err != nil {
+		return notFound(err, "group")
+	}
+	if err := checkRole(c, &group, model.RoleOwner); err != nil {
+		return err
+	}
+	if group.DeletedAt == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "the group is not in the trash")
+	}
+	if err := checkIfMatch(c, group.Version); err != nil {
+		return err
+	}
+
+	restored := group
+	restored.DeletedAt = nil
+	restored.Version++
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.groups.SetDeletedAt(ctx, groupId, group.Version, nil); err != nil {
+			return versionConflict(err, "group")
+		}
+		return api.recordGroup(ctx, c, model.ActionRestore, &group, &restored)
+	})
+	if err != nil {
+		return err
+	}
+	group = restored
+
+	setETag(c, group.Version)
+	return c.JSON(group)
+}
+
+// @Summary      Returns the transactions of a group that are in the trash
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.Transaction
+// @Router       /groups/{id}/trash [get]
+func (api *Api) GetGroupTrash(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.memberGroup(c, groupId); err != nil {
+		return err
+	}
+
+	transactions, err := api.transactions.List(c.Context(), store.TransactionFilter{
+		Group:    groupId,
+		Deletion: store.Deleted,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(transactions)
+}
+
+// @Summary      Restores a transaction from the trash
+// @Param        id   path      string  true  "Transaction ID"
+// @Param        If-Match  header  string  true  "ETag of the transaction"
+// @Success      200  {object}  model.Transaction
+// @Router       /transactions/{id}/restore [post]
+func (api *Api) RestoreTransaction(c *fiber.Ctx) error {
+	transactionId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	transaction, err := api.transactions.Get(c.Context(), transactionId)
+	if err != nil {
+		return notFound(err, "transaction")
+	}
+	if _, err := api.memberGroup(c, transaction.Group); err != nil {
+		return err
+	}
+	if transaction.DeletedAt == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "the transaction is not in the trash")
+	}
+	if err := checkIfMatch(c, transaction.Version); err != nil {
+		return err
+	}
+
+	restored := transaction
+	restored.DeletedAt = nil
+	restored.Version++
+	err = api.withTransaction(c.Context(), func(ctx context.Context) error {
+		if err := api.transactions.SetDeletedAt(ctx, transactionId, transaction.Version, nil); err != nil {
+			return versionConflict(err, "transaction")
+		}
+		return api.recordTransaction(ctx, c, model.ActionRestore, &transaction, &restored)
+	})
+	if err != nil {
+		return err
+	}
+	transaction = restored
+
+	setETag(c, transaction.Version)
+	return c.JSON(transaction)
+}
+
+// PurgeTrash permanently deletes the groups and transactions moved to the trash before the given time.
+// The transactions, invitations and recurring transactions of a purged group are deleted with it.
+func (api *Api) PurgeTrash(ctx context.Context, before time.Time) error {
+	groups, err := api.groups.List(ctx, store.GroupFilter{Deletion: store.Deleted, DeletedBefore: before})
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		err = api.Store.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := api.transactions.DeleteForGroup(ctx, group.Id); err != nil {
+				return err
+			}
+			if err := api.invitations.DeleteForGroup(ctx, group.Id); err != nil {
+				return err
+			}
+			if err := api.recurring.DeleteForGroup(ctx, group.Id); err != nil {
+				return err
+			}
+			if err := api.webhooks.DeleteForGroup(ctx, group.Id); err != nil {
+				return err
+			}
+			if err := api.deliveries.DeleteForGroup(ctx, group.Id); err != nil {
+				return err
+			}
+			return api.groups.Delete(ctx, group.Id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	transactions, err := api.transactions.List(ctx, store.TransactionFilter{Deletion: store.Deleted, DeletedBefore: before})
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		err = api.transactions.Delete(ctx, transaction.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunTrashPurge purges the trash every interval, keeping what was deleted less than retention ago, until ctx is done
+func (api *Api) RunTrashPurge(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.PurgeTrash(ctx, time.Now().Add(-retention)); err != nil {
+			log.Printf("could not purge the trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
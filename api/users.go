@@ -1,33 +1,44 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/triplan-planning/api-go/model"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func (api *Api) GetUsers(c *fiber.Ctx) error {
-
-	filter := bson.M{}
-	if query := c.Query("name"); query != "" {
-		filter["name"] = primitive.Regex{Pattern: query, Options: "i"}
+// hideEmails removes the emails of the users but the current one, emails are only sent to their owner, see GetMe
+func hideEmails(c *fiber.Ctx, users []model.User) {
+	me := currentUser(c).Id
+	for i := range users {
+		if users[i].Id != me {
+			users[i].Email = ""
+		}
 	}
+}
 
-	res, err := api.usersColl.Find(c.Context(), filter)
+func (api *Api) GetUsers(c *fiber.Ctx) error {
+	page, err := pageQuery(c, store.SortCreated, store.SortCreated, store.SortName)
 	if err != nil {
 		return err
 	}
 
-	var users []model.User
-	err = res.All(c.Context(), &users)
+	users, err := api.users.List(c.Context(), store.UserFilter{Name: c.Query("name"), Page: page})
 	if err != nil {
 		return err
 	}
+	hideEmails(c, users)
 
-	return c.JSON(users)
+	response, err := newPage(users, page, store.UserCursor)
+	if err != nil {
+		return err
+	}
+	return c.JSON(response)
 }
 
 func (api *Api) GetUserInfo(c *fiber.Ctx) error {
@@ -36,19 +47,15 @@ func (api *Api) GetUserInfo(c *fiber.Ctx) error {
 		return err
 	}
 
-	res := api.usersColl.FindOne(c.Context(), bson.M{
-		"_id": userId,
-	})
-	if res.Err() != nil {
-		return res.Err()
-	}
-
-	var user model.User
-	err = res.Decode(&user)
+	user, err := api.users.Get(c.Context(), userId)
 	if err != nil {
-		return err
+		return notFound(err, "user")
+	}
+	if user.Id != currentUser(c).Id {
+		user.Email = ""
 	}
 
+	setETag(c, user.Version)
 	return c.JSON(user)
 }
 
@@ -61,14 +68,18 @@ func (api *Api) PostUser(c *fiber.Ctx) error {
 	if user.Name == "" {
 		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
 	}
-	user.Id = primitive.NilObjectID
+	// users created by someone else have no account, see Signup
+	user.Email = ""
+	user.PasswordHash = nil
+	me := currentUser(c).Id
+	user.CreatedBy = &me
 
-	res, err := api.usersColl.InsertOne(c.Context(), user)
+	err = api.users.Insert(c.Context(), &user)
 	if err != nil {
 		return err
 	}
-	user.Id = res.InsertedID.(primitive.ObjectID)
 
+	setETag(c, user.Version)
 	return c.JSON(user)
 }
 
@@ -77,11 +88,41 @@ func (api *Api) DeleteUser(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	user, err := api.userWithAccess(c, userId)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, user.Version); err != nil {
+		return err
+	}
 
-	_, err = api.usersColl.DeleteOne(c.Context(), bson.M{
-		"_id": userId,
+	err = api.Store.WithTransaction(c.Context(), func(ctx context.Context) error {
+		// users can not be removed from the balances of their groups
+		groups, err := api.groups.List(ctx, store.GroupFilter{User: userId, IncludeFormerUsers: true, Deletion: store.AnyDeletion})
+		if err != nil {
+			return err
+		}
+		if len(groups) != 0 {
+			names := make([]string, len(groups))
+			for i, group := range groups {
+				names[i] = strconv.Quote(group.Name)
+			}
+			return fmt.Errorf("%w: the user is still referenced by the groups %s", fiber.ErrConflict, strings.Join(names, ", "))
+		}
+		transactions, err := api.transactions.List(ctx, store.TransactionFilter{User: userId, Deletion: store.AnyDeletion})
+		if err != nil {
+			return err
+		}
+		if len(transactions) != 0 {
+			return fmt.Errorf("%w: the user is still referenced by %d transactions", fiber.ErrConflict, len(transactions))
+		}
+
+		err = api.sessions.DeleteForUser(ctx, userId)
+		if err != nil {
+			return err
+		}
+		return api.users.Delete(ctx, userId)
 	})
-
 	if err != nil {
 		return err
 	}
@@ -90,8 +131,76 @@ func (api *Api) DeleteUser(c *fiber.Ctx) error {
 	return nil
 }
 
-func (api *Api) PutUser(c *fiber.Ctx) error {
+// userWithAccess returns a user the current user can update or delete: the current user themselves, or a user
+// without an account created by the current user or in one of the groups of the current user
+func (api *Api) userWithAccess(c *fiber.Ctx, userId primitive.ObjectID) (model.User, error) {
+	me := currentUser(c)
+	if userId == me.Id {
+		return me, nil
+	}
+
+	user, err := api.users.Get(c.Context(), userId)
+	if err != nil {
+		return user, notFound(err, "user")
+	}
+	forbidden := fiber.NewError(fiber.StatusForbidden, "users can only change their own account, or the users without an account of their groups")
+	if user.HasAccount() {
+		return user, forbidden
+	}
+	if user.CreatedBy != nil && *user.CreatedBy == me.Id {
+		return user, nil
+	}
+	groups, err := api.groups.List(c.Context(), store.GroupFilter{User: userId, IncludeFormerUsers: true, Deletion: store.AnyDeletion})
+	if err != nil {
+		return user, err
+	}
+	for _, group := range groups {
+		if group.HasMember(me.Id) {
+			return user, nil
+		}
+	}
+	return user, forbidden
+}
+
+// editedUser returns the user the request is about if the current user can edit it and the request has its version
+func (api *Api) editedUser(c *fiber.Ctx) (model.User, error) {
 	userId, err := getId(c.Params("id"))
+	if err != nil {
+		return model.User{}, err
+	}
+	stored, err := api.userWithAccess(c, userId)
+	if err != nil {
+		return stored, err
+	}
+	if err := checkIfMatch(c, stored.Version); err != nil {
+		return stored, err
+	}
+	return stored, nil
+}
+
+// updateUser validates user and replaces the stored user with it
+func (api *Api) updateUser(c *fiber.Ctx, stored model.User, user model.User) error {
+	if user.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
+	}
+	// credentials can only be set on signup
+	user.Id = stored.Id
+	user.Email = stored.Email
+	user.PasswordHash = stored.PasswordHash
+	user.CreatedBy = stored.CreatedBy
+	user.Version = stored.Version
+
+	err := api.users.Replace(c.Context(), &user)
+	if err != nil {
+		return versionConflict(err, "user")
+	}
+
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
+
+func (api *Api) PutUser(c *fiber.Ctx) error {
+	stored, err := api.editedUser(c)
 	if err != nil {
 		return err
 	}
@@ -101,23 +210,21 @@ func (api *Api) PutUser(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	if user.Name == "" {
-		return fiber.NewError(fiber.StatusBadRequest, `field "name" must be non-empty`)
-	}
-	user.Id = userId
+
+	return api.updateUser(c, stored, user)
+}
+
+// PatchUser applies the JSON merge patch (RFC 7396) in the body to a user
+func (api *Api) PatchUser(c *fiber.Ctx) error {
+	stored, err := api.editedUser(c)
 	if err != nil {
 		return err
 	}
 
-	res, err := api.usersColl.ReplaceOne(c.Context(), bson.M{
-		"_id": user.Id,
-	}, user)
+	user, err := mergePatch(c, &stored)
 	if err != nil {
 		return err
 	}
-	if res.ModifiedCount != 1 {
-		return fmt.Errorf("could not update user")
-	}
 
-	return c.JSON(user)
+	return api.updateUser(c, stored, user)
 }
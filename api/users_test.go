@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserEmailsHidden(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+
+	var me model.User
+	a.mustDo(fiber.StatusOK, "GET", "/auth/me", ann.Token, nil, &me)
+	if me.Email != "ann@example.com" {
+		t.Errorf("email from /auth/me = %q, want ann@example.com", me.Email)
+	}
+	var user model.User
+	a.mustDo(fiber.StatusOK, "GET", "/users/"+ann.User.Id.Hex(), ann.Token, nil, &user)
+	if user.Email != "ann@example.com" {
+		t.Errorf("email of ann sent to herself = %q, want ann@example.com", user.Email)
+	}
+
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id}}, &group)
+	// checks that every user sent to bob has no email
+	sentToBob := func(source string, users ...model.User) {
+		for _, user := range users {
+			if user.Id != bob.User.Id && user.Email != "" {
+				t.Errorf("%s: the email of %s is sent to bob", source, user.Name)
+			}
+		}
+	}
+	var annForBob model.User
+	a.mustDo(fiber.StatusOK, "GET", "/users/"+ann.User.Id.Hex(), bob.Token, nil, &annForBob)
+	sentToBob("GET /users/:id", annForBob)
+	var users Page[model.User]
+	a.mustDo(fiber.StatusOK, "GET", "/users?name=ann", bob.Token, nil, &users)
+	sentToBob("GET /users", users.Items...)
+	var members []model.User
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/users", bob.Token, nil, &members)
+	sentToBob("GET /groups/:id/users", members...)
+
+	var backup model.GroupBackup
+	a.mustDo(fiber.StatusOK, "GET", "/groups/"+group.Id.Hex()+"/backup", ann.Token, nil, &backup)
+	for _, user := range backup.Users {
+		if user.Id == bob.User.Id && user.Email != "" {
+			t.Errorf("the archive made by ann has the email of bob")
+		}
+	}
+}
+
+func TestUsersWithoutAccount(t *testing.T) {
+	a := newTestApp(t)
+	ann := a.signup("ann")
+	bob := a.signup("bob")
+	carol := a.signup("carol")
+
+	var guest model.User
+	a.mustDo(fiber.StatusOK, "POST", "/users", ann.Token, model.User{Name: "guest"}, &guest)
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id, bob.User.Id, guest.Id}}, &group)
+
+	// the members of the group of the guest can rename them, others can not
+	a.mustDo(fiber.StatusForbidden, "PATCH", "/users/"+guest.Id.Hex(), carol.Token, map[string]any{"name": "carol's guest"}, nil, fiber.HeaderIfMatch, etag(guest.Version))
+	a.mustDo(fiber.StatusOK, "PATCH", "/users/"+guest.Id.Hex(), bob.Token, map[string]any{"name": "dan"}, &guest, fiber.HeaderIfMatch, etag(guest.Version))
+	if guest.Name != "dan" {
+		t.Errorf("name of the guest = %q, want dan", guest.Name)
+	}
+	// accounts can only be changed by their owner
+	a.mustDo(fiber.StatusForbidden, "PATCH", "/users/"+ann.User.Id.Hex(), bob.Token, map[string]any{"name": "bob's"}, nil, fiber.HeaderIfMatch, etag(ann.User.Version))
+	a.mustDo(fiber.StatusForbidden, "DELETE", "/users/"+ann.User.Id.Hex(), bob.Token, nil, nil, fiber.HeaderIfMatch, etag(ann.User.Version))
+
+	// once out of every group, the guest can be deleted by their creator
+	a.mustDo(fiber.StatusConflict, "DELETE", "/users/"+guest.Id.Hex(), ann.Token, nil, nil, fiber.HeaderIfMatch, etag(guest.Version))
+	a.mustDo(fiber.StatusOK, "DELETE", "/groups/"+group.Id.Hex()+"/members/"+guest.Id.Hex(), ann.Token, nil, nil)
+	a.mustDo(fiber.StatusForbidden, "DELETE", "/users/"+guest.Id.Hex(), bob.Token, nil, nil, fiber.HeaderIfMatch, etag(guest.Version))
+	a.mustDo(fiber.StatusNoContent, "DELETE", "/users/"+guest.Id.Hex(), ann.Token, nil, nil, fiber.HeaderIfMatch, etag(guest.Version))
+	a.mustDo(fiber.StatusNotFound, "GET", "/users/"+guest.Id.Hex(), ann.Token, nil, nil)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/store"
+)
+
+// etag returns the entity tag of a document, see model.User.Version
+func etag(version uint32) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+// setETag sends the version of the returned document, to be sent back in If-Match to update it
+func setETag(c *fiber.Ctx, version uint32) {
+	c.Set(fiber.HeaderETag, etag(version))
+}
+
+// checkIfMatch refuses to change a document unless the If-Match header names its current version
+func checkIfMatch(c *fiber.Ctx, version uint32) error {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return fiber.NewError(fiber.StatusPreconditionRequired, `header "If-Match" must be set to the ETag of the document`)
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// weak tags never match, If-Match uses the strong comparison
+		if tag == "*" || tag == etag(version) {
+			return nil
+		}
+	}
+	return fiber.NewError(fiber.StatusPreconditionFailed, "the document was modified since it was read")
+}
+
+// versionConflict turns a store.ErrVersionConflict into a 412, and a store.ErrNotFound into a 404
+func versionConflict(err error, entity string) error {
+	if errors.Is(err, store.ErrVersionConflict) {
+		return fiber.NewError(fiber.StatusPreconditionFailed, "the "+entity+" was modified since it was read")
+	}
+	return notFound(err, entity)
+}
@@ -0,0 +1,500 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"github.com/triplan-planning/api-go/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// webhookTimeout is how long a webhook has to answer a delivery
+	webhookTimeout = 10 * time.Second
+	// webhookWorkers is how many webhooks are sent their deliveries at the same time
+	webhookWorkers = 8
+)
+
+// newWebhookClient returns the client sending deliveries, redirects are not followed and count as failures.
+// Unless allowPrivate is set, connections to addresses refused by model.IsPublicAddress fail, even when a host
+// resolves to another address than when its webhook was saved.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !model.IsPublicAddress(ip) {
+				return fmt.Errorf("deliveries can not be sent to %s", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would make the connection instead of the dialer
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   webhookTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Secret signs the deliveries. It is generated when creating a webhook without one, and kept when updating a webhook without one.
+	Secret string `json:"secret,omitempty"`
+	// Events limits the events sent to the webhook, all of them are sent when empty
+	Events []model.EventType `json:"events,omitempty"`
+}
+
+// adminWebhook loads a webhook from a group the current user is an admin of
+func (api *Api) adminWebhook(c *fiber.Ctx) (model.Webhook, error) {
+	webhookId, err := getId(c.Params("id"))
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	webhook, err := api.webhooks.Get(c.Context(), webhookId)
+	if err != nil {
+		return webhook, notFound(err, "webhook")
+	}
+	_, err = api.groupWithRole(c, webhook.Group, model.RoleAdmin)
+	return webhook, err
+}
+
+// AllowPrivateWebhooks lets webhooks point to loopback, private and link-local addresses, for local development
+func (api *Api) AllowPrivateWebhooks() {
+	api.allowPrivateWebhooks = true
+	api.webhookClient = newWebhookClient(true)
+}
+
+// checkWebhook validates a webhook, generating its secret when it has none.
+// Resolving its host is cancelled with ctx and takes at most webhookTimeout.
+func (api *Api) checkWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if webhook.Secret == "" {
+		secret, err := randomToken()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	if err := webhook.Validate(ctx, api.allowPrivateWebhooks); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// @Summary      Returns the webhooks of a group, without their secret
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {array}   model.Webhook
+// @Router       /groups/{id}/webhooks [get]
+func (api *Api) GetGroupWebhooks(c *fiber.Ctx) error {
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.groupWithRole(c, groupId, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	webhooks, err := api.webhooks.List(c.Context(), groupId)
+	if err != nil {
+		return err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return c.JSON(webhooks)
+}
+
+// @Summary      Registers a webhook, the changes of the transactions and members of the group are sent to it
+// @Description  Each delivery is a POST of the event as JSON. Its X-Triplan-Signature header is "sha256=" followed by the hex HMAC-SHA256,
+// @Description  keyed by the secret, of the X-Triplan-Timestamp header, a dot and the body. Failed deliveries are retried with an exponential backoff.
+// @Accept       json
+// @Param        id   path      string  true  "Group ID"
+// @Param        webhook  body      WebhookRequest  true  "The URL of the webhook"
+// @Success      200  {object}  model.Webhook
+// @Router       /groups/{id}/webhooks [post]
+func (api *Api) PostGroupWebhook(c *fiber.Ctx) error {
+	var request WebhookRequest
+	err := c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	groupId, err := getId(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if _, err := api.groupWithRole(c, groupId, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	webhook := model.Webhook{
+		Group:     groupId,
+		URL:       request.URL,
+		Secret:    request.Secret,
+		Events:    request.Events,
+		CreatedBy: currentUser(c).Id,
+		CreatedAt: time.Now(),
+	}
+	if err := api.checkWebhook(c.Context(), &webhook); err != nil {
+		return err
+	}
+
+	err = api.webhooks.Insert(c.Context(), &webhook)
+	if err != nil {
+		return err
+	}
+
+	setETag(c, webhook.Version)
+	return c.JSON(webhook)
+}
+
+// @Summary      Returns a webhook, without its secret
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  model.Webhook
+// @Router       /webhooks/{id} [get]
+func (api *Api) GetWebhook(c *fiber.Ctx) error {
+	webhook, err := api.adminWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	webhook.Secret = ""
+	setETag(c, webhook.Version)
+	return c.JSON(webhook)
+}
+
+// @Summary      Updates a webhook, the secret is only sent back when a new one is given
+// @Accept       json
+// @Param        id   path      string  true  "Webhook ID"
+// @Param        If-Match  header  string  true  "ETag of the webhook"
+// @Param        webhook  body      WebhookRequest  true  "The URL of the webhook"
+// @Success      200  {object}  model.Webhook
+// @Router       /webhooks/{id} [put]
+func (api *Api) PutWebhook(c *fiber.Ctx) error {
+	stored, err := api.adminWebhook(c)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, stored.Version); err != nil {
+		return err
+	}
+
+	var request WebhookRequest
+	err = c.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+
+	webhook := stored
+	webhook.URL = request.URL
+	webhook.Events = request.Events
+	if request.Secret != "" {
+		webhook.Secret = request.Secret
+	}
+	if err := api.checkWebhook(c.Context(), &webhook); err != nil {
+		return err
+	}
+
+	err = api.webhooks.Replace(c.Context(), &webhook)
+	if err != nil {
+		return versionConflict(err, "webhook")
+	}
+
+	if request.Secret == "" {
+		webhook.Secret = ""
+	}
+	setETag(c, webhook.Version)
+	return c.JSON(webhook)
+}
+
+// @Summary      Deletes a webhook and its deliveries
+// @Param        id   path      string  true  "Webhook ID"
+// @Param        If-Match  header  string  true  "ETag of the webhook"
+// @Success      204
+// @Router       /webhooks/{id} [delete]
+func (api *Api) DeleteWebhook(c *fiber.Ctx) error {
+	webhook, err := api.adminWebhook(c)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, webhook.Version); err != nil {
+		return err
+	}
+
+	err = api.webhooks.Delete(c.Context(), webhook.Id)
+	if err != nil {
+		return err
+	}
+	err = api.deliveries.DeleteForWebhook(c.Context(), webhook.Id)
+	if err != nil {
+		return err
+	}
+
+	c.Status(fiber.StatusNoContent)
+	return nil
+}
+
+// @Summary      Returns the delivery log of a webhook, newest first
+// @Param        id   path      string  true  "Webhook ID"
+// @Param        limit  query     int     false  "Maximum number of deliveries, 100 by default"
+// @Success      200  {array}   model.WebhookDelivery
+// @Router       /webhooks/{id}/deliveries [get]
+func (api *Api) GetWebhookDeliveries(c *fiber.Ctx) error {
+	webhook, err := api.adminWebhook(c)
+	if err != nil {
+		return err
+	}
+	limit, err := limitQuery(c)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := api.deliveries.List(c.Context(), webhook.Id, limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(deliveries)
+}
+
+// @Summary      Sends the event of a delivery again, as a new delivery
+// @Description  The event keeps its id, receivers can use it to ignore the events they already handled.
+// @Param        id          path      string  true  "Webhook ID"
+// @Param        deliveryId  path      string  true  "Delivery ID"
+// @Success      202  {object}  model.WebhookDelivery
+// @Router       /webhooks/{id}/deliveries/{deliveryId}/replay [post]
+func (api *Api) ReplayWebhookDelivery(c *fiber.Ctx) error {
+	webhook, err := api.adminWebhook(c)
+	if err != nil {
+		return err
+	}
+	deliveryId, err := getId(c.Params("deliveryId"))
+	if err != nil {
+		return err
+	}
+
+	delivery, err := api.deliveries.Get(c.Context(), deliveryId)
+	if err != nil {
+		return notFound(err, "delivery")
+	}
+	if delivery.Webhook != webhook.Id {
+		return notFound(store.ErrNotFound, "delivery")
+	}
+
+	replay := model.NewWebhookDelivery(&webhook, delivery.Event, time.Now())
+	replay.ReplayOf = &delivery.Id
+	err = api.deliveries.Insert(c.Context(), &replay)
+	if err != nil {
+		return err
+	}
+	api.wakeWebhooks()
+
+	c.Status(fiber.StatusAccepted)
+	return c.JSON(replay)
+}
+
+// enqueueDeliveries creates a delivery of the event for each webhook of its group that accepts it
+func (api *Api) enqueueDeliveries(ctx context.Context, event model.Event) {
+	webhooks, err := api.webhooks.List(ctx, event.Group)
+	if err != nil {
+		log.Printf("could not list the webhooks of group %s: %v", event.Group.Hex(), err)
+		return
+	}
+
+	queued := false
+	for i := range webhooks {
+		if !webhooks[i].Accepts(event.Type) {
+			continue
+		}
+		delivery := model.NewWebhookDelivery(&webhooks[i], event, time.Now())
+		if err := api.deliveries.Insert(ctx, &delivery); err != nil {
+			log.Printf("could not queue event %s for webhook %s: %v", event.Id.Hex(), webhooks[i].Id.Hex(), err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		api.wakeWebhooks()
+	}
+}
+
+// wakeWebhooks makes RunWebhookDeliveries attempt the due deliveries without waiting for its interval
+func (api *Api) wakeWebhooks() {
+	select {
+	case api.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDueWebhooks attempts the deliveries due at the given time. Webhooks are sent their deliveries
+// concurrently, each one oldest first: after a failed attempt, the other deliveries to the same webhook
+// wait for the next call.
+func (api *Api) DeliverDueWebhooks(ctx context.Context, now time.Time, retryDelay time.Duration) error {
+	due, err := api.deliveries.ListDue(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	var order []primitive.ObjectID
+	byWebhook := map[primitive.ObjectID][]model.WebhookDelivery{}
+	for _, delivery := range due {
+		if _, ok := byWebhook[delivery.Webhook]; !ok {
+			order = append(order, delivery.Webhook)
+		}
+		byWebhook[delivery.Webhook] = append(byWebhook[delivery.Webhook], delivery)
+	}
+
+	queue := make(chan primitive.ObjectID)
+	errs := make(chan error, len(order))
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers && i < len(order); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for webhookId := range queue {
+				if err := api.deliverWebhook(ctx, webhookId, byWebhook[webhookId], retryDelay); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for _, webhookId := range order {
+		queue <- webhookId
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+
+	// the other webhooks were sent their deliveries, only the first error is returned
+	return <-errs
+}
+
+// deliverWebhook attempts the due deliveries of a webhook in order, until one fails
+func (api *Api) deliverWebhook(ctx context.Context, webhookId primitive.ObjectID, due []model.WebhookDelivery, retryDelay time.Duration) error {
+	webhook, err := api.webhooks.Get(ctx, webhookId)
+	if errors.Is(err, store.ErrNotFound) {
+		// the deliveries of a deleted webhook are deleted with it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range due {
+		delivery := &due[i]
+		attempt := api.postWebhook(ctx, &webhook, delivery)
+		delivery.Record(attempt, retryDelay)
+		if err := api.deliveries.Replace(ctx, delivery); err != nil {
+			log.Printf("could not save delivery %s: %v", delivery.Id.Hex(), err)
+		}
+		if attempt.Error != "" {
+			break
+		}
+	}
+	return nil
+}
+
+// PurgeWebhookDeliveries deletes the deliveries created before the given time that have no attempt left
+func (api *Api) PurgeWebhookDeliveries(ctx context.Context, before time.Time) error {
+	return api.deliveries.DeleteFinished(ctx, before)
+}
+
+// postWebhook sends a delivery to its webhook, the attempt fails unless the webhook answers with a 2xx status
+func (api *Api) postWebhook(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) model.WebhookAttempt {
+	attempt := model.WebhookAttempt{Time: time.Now()}
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Triplan-Webhooks/1.0")
+	req.Header.Set("X-Triplan-Event", string(delivery.Event.Type))
+	req.Header.Set("X-Triplan-Delivery", delivery.Id.Hex())
+	req.Header.Set("X-Triplan-Timestamp", strconv.FormatInt(attempt.Time.Unix(), 10))
+	req.Header.Set("X-Triplan-Signature", "sha256="+webhook.Sign(attempt.Time, body))
+
+	res, err := api.webhookClient.Do(req)
+	attempt.Duration = time.Since(attempt.Time).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	// reading the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("the webhook answered with status %d", res.StatusCode)
+	}
+	return attempt
+}
+
+// RunWebhookDeliveries attempts the due deliveries every interval, and as soon as new ones are queued, until ctx is done.
+// Failed attempts are retried after retryDelay, then twice as long after each failure.
+func (api *Api) RunWebhookDeliveries(ctx context.Context, interval time.Duration, retryDelay time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.DeliverDueWebhooks(ctx, time.Now(), retryDelay); err != nil {
+			log.Printf("could not deliver the webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-api.webhookWake:
+		}
+	}
+}
+
+// RunWebhookDeliveryPurge deletes the finished deliveries older than retention every interval until ctx is done
+func (api *Api) RunWebhookDeliveryPurge(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.PurgeWebhookDeliveries(ctx, time.Now().Add(-retention)); err != nil {
+			log.Printf("could not purge the webhook deliveries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSecret = "0123456789abcdef0123"
+
+// standIn is a webhook receiver checking the signature of the deliveries, it fails the first one
+type standIn struct {
+	t          *testing.T
+	server     *httptest.Server
+	mu         sync.Mutex
+	events     []model.Event
+	deliveries []string
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{t: t}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(testSecret))
+		mac.Write([]byte(r.Header.Get("X-Triplan-Timestamp") + "."))
+		mac.Write(body)
+		if r.Header.Get("X-Triplan-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("delivery %s has a bad signature", r.Header.Get("X-Triplan-Delivery"))
+		}
+		var event model.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("delivery %s: %v", r.Header.Get("X-Triplan-Delivery"), err)
+		}
+		if r.Header.Get("X-Triplan-Event") != string(event.Type) {
+			t.Errorf("delivery %s: event header %s for a %s event", r.Header.Get("X-Triplan-Delivery"), r.Header.Get("X-Triplan-Event"), event.Type)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.events = append(s.events, event)
+		s.deliveries = append(s.deliveries, r.Header.Get("X-Triplan-Delivery"))
+		if len(s.events) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *standIn) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// newWebhookGroup creates a group of ann and returns it with her session
+func newWebhookGroup(a *testApp) (SessionResponse, model.Group) {
+	ann := a.signup("ann")
+	var group model.Group
+	a.mustDo(fiber.StatusOK, "POST", "/groups", ann.Token, model.Group{Name: "trip", Users: []primitive.ObjectID{ann.User.Id}}, &group)
+	return ann, group
+}
+
+func postTestTransaction(a *testApp, session SessionResponse, group model.Group) model.Transaction {
+	var transaction model.Transaction
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/transactions", session.Token, map[string]any{
+		"paidBy":   session.User.Id,
+		"paidFor":  []map[string]any{{"user": session.User.Id, "weight": 1}},
+		"amount":   100,
+		"date":     "2024-01-01T00:00:00Z",
+		"category": "food",
+	}, &transaction)
+	return transaction
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	a := newTestApp(t)
+	a.api.AllowPrivateWebhooks()
+	standIn := newStandIn(t)
+	ann, group := newWebhookGroup(a)
+
+	var webhook model.Webhook
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/webhooks", ann.Token, WebhookRequest{URL: standIn.server.URL + "/hook", Secret: testSecret}, &webhook)
+	transaction := postTestTransaction(a, ann, group)
+
+	ctx := context.Background()
+	deliveries := func() []model.WebhookDelivery {
+		var deliveries []model.WebhookDelivery
+		a.mustDo(fiber.StatusOK, "GET", "/webhooks/"+webhook.Id.Hex()+"/deliveries", ann.Token, nil, &deliveries)
+		return deliveries
+	}
+
+	// the first attempt fails and is retried after the retry delay
+	if err := a.api.DeliverDueWebhooks(ctx, time.Now(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	entries := deliveries()
+	if len(entries) != 1 || entries[0].Status != model.DeliveryPending || len(entries[0].Attempts) != 1 || entries[0].Attempts[0].StatusCode != 500 {
+		t.Fatalf("delivery log after a failure = %+v", entries)
+	}
+	if wait := entries[0].NextAttempt.Sub(entries[0].Attempts[0].Time); wait < time.Minute-time.Millisecond || wait > time.Minute+time.Millisecond {
+		t.Errorf("next attempt after %s, want a minute", wait)
+	}
+	if err := a.api.DeliverDueWebhooks(ctx, time.Now().Add(30*time.Second), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := standIn.received(); got != 1 {
+		t.Fatalf("the stand-in received %d deliveries before the retry delay, want 1", got)
+	}
+	if err := a.api.DeliverDueWebhooks(ctx, time.Now().Add(time.Minute+time.Second), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	entries = deliveries()
+	if len(entries) != 1 || entries[0].Status != model.DeliverySucceeded || len(entries[0].Attempts) != 2 || entries[0].NextAttempt != nil {
+		t.Fatalf("delivery log after a retry = %+v", entries)
+	}
+	event := standIn.events[1]
+	if event.Type != model.EventTransactionCreated || event.EntityId != transaction.Id || event.Group != group.Id {
+		t.Errorf("delivered event = %+v, want the creation of transaction %s", event, transaction.Id.Hex())
+	}
+
+	// a replay is a new delivery of the same event
+	var replay model.WebhookDelivery
+	a.mustDo(fiber.StatusAccepted, "POST", "/webhooks/"+webhook.Id.Hex()+"/deliveries/"+entries[0].Id.Hex()+"/replay", ann.Token, nil, &replay)
+	if err := a.api.DeliverDueWebhooks(ctx, time.Now(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := standIn.received(); got != 3 {
+		t.Fatalf("the stand-in received %d deliveries after a replay, want 3", got)
+	}
+	if standIn.events[2].Id != event.Id || standIn.deliveries[2] != replay.Id.Hex() || *replay.ReplayOf != entries[0].Id {
+		t.Errorf("replayed event %s in delivery %s, want event %s in delivery %s", standIn.events[2].Id.Hex(), standIn.deliveries[2], event.Id.Hex(), replay.Id.Hex())
+	}
+
+	// finished deliveries are kept for the retention only
+	if err := a.api.PurgeWebhookDeliveries(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(deliveries()); got != 2 {
+		t.Fatalf("%d deliveries after a purge of older ones, want 2", got)
+	}
+	if err := a.api.PurgeWebhookDeliveries(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(deliveries()); got != 0 {
+		t.Errorf("%d deliveries after a purge, want 0", got)
+	}
+}
+
+func TestWebhookDeliveriesConcurrent(t *testing.T) {
+	a := newTestApp(t)
+	a.api.AllowPrivateWebhooks()
+	ann, group := newWebhookGroup(a)
+
+	// the slow webhook only answers once the fast one was sent its delivery
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			w.WriteHeader(http.StatusNoContent)
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(slow.Close)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(release)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(fast.Close)
+
+	var slowHook model.Webhook
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/webhooks", ann.Token, WebhookRequest{URL: slow.URL, Secret: testSecret}, &slowHook)
+	a.mustDo(fiber.StatusOK, "POST", "/groups/"+group.Id.Hex()+"/webhooks", ann.Token, WebhookRequest{URL: fast.URL, Secret: testSecret}, nil)
+	postTestTransaction(a, ann, group)
+
+	if err := a.api.DeliverDueWebhooks(context.Background(), time.Now(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var entries []model.WebhookDelivery
+	a.mustDo(fiber.StatusOK, "GET", "/webhooks/"+slowHook.Id.Hex()+"/deliveries", ann.Token, nil, &entries)
+	if len(entries) != 1 || entries[0].Status != model.DeliverySucceeded {
+		t.Errorf("delivery log of the slow webhook = %+v, want a success", entries)
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	a := newTestApp(t)
+	standIn := newStandIn(t)
+	ann, group := newWebhookGroup(a)
+
+	a.mustDo(fiber.StatusBadRequest, "POST", "/groups/"+group.Id.Hex()+"/webhooks", ann.Token, WebhookRequest{URL: standIn.server.URL}, nil)
+	a.mustDo(fiber.StatusBadRequest, "POST", "/groups/"+group.Id.Hex()+"/webhooks", ann.Token, WebhookRequest{URL: "http://169.254.169.254/latest/meta-data"}, nil)
+
+	// a host can resolve to another address once its webhook is saved, connections are checked too
+	webhook := model.Webhook{Group: group.Id, URL: standIn.server.URL, Secret: testSecret}
+	if err := a.api.webhooks.Insert(context.Background(), &webhook); err != nil {
+		t.Fatal(err)
+	}
+	postTestTransaction(a, ann, group)
+	if err := a.api.DeliverDueWebhooks(context.Background(), time.Now(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := standIn.received(); got != 0 {
+		t.Fatalf("the stand-in received %d deliveries, want none", got)
+	}
+	var entries []model.WebhookDelivery
+	a.mustDo(fiber.StatusOK, "GET", "/webhooks/"+webhook.Id.Hex()+"/deliveries", ann.Token, nil, &entries)
+	if len(entries) != 1 || len(entries[0].Attempts) != 1 || !strings.Contains(entries[0].Attempts[0].Error, "can not be sent") {
+		t.Errorf("delivery log = %+v, want an attempt refused by the dialer", entries)
+	}
+}
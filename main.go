@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -11,6 +13,7 @@ import (
 	"github.com/gofiber/swagger"
 	"github.com/triplan-planning/api-go/api"
 	_ "github.com/triplan-planning/api-go/docs"
+	"github.com/triplan-planning/api-go/store"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -27,6 +30,58 @@ func getPort() string {
 	return port
 }
 
+// getTrashRetention returns how long deleted groups and transactions stay in the trash, 30 days by default
+func getTrashRetention() time.Duration {
+	retention, ok := os.LookupEnv("TRASH_RETENTION")
+	if !ok || retention == "" {
+		return 30 * 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(retention)
+	if err != nil {
+		panic("env variable TRASH_RETENTION must be a duration like \"720h\": " + err.Error())
+	}
+	return duration
+}
+
+// getWebhookRetryDelay returns how long a failed webhook delivery waits before its first retry, 30 seconds by default
+func getWebhookRetryDelay() time.Duration {
+	delay, ok := os.LookupEnv("WEBHOOK_RETRY_DELAY")
+	if !ok || delay == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(delay)
+	if err != nil || duration <= 0 {
+		panic("env variable WEBHOOK_RETRY_DELAY must be a positive duration like \"30s\"")
+	}
+	return duration
+}
+
+// getWebhookDeliveryRetention returns how long finished webhook deliveries stay in the delivery log, 30 days by default
+func getWebhookDeliveryRetention() time.Duration {
+	retention, ok := os.LookupEnv("WEBHOOK_DELIVERY_RETENTION")
+	if !ok || retention == "" {
+		return 30 * 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(retention)
+	if err != nil {
+		panic("env variable WEBHOOK_DELIVERY_RETENTION must be a duration like \"720h\": " + err.Error())
+	}
+	return duration
+}
+
+// getWebhookAllowPrivate tells whether webhooks can point to loopback, private and link-local addresses, only for local development
+func getWebhookAllowPrivate() bool {
+	allow, ok := os.LookupEnv("WEBHOOK_ALLOW_PRIVATE")
+	if !ok || allow == "" {
+		return false
+	}
+	value, err := strconv.ParseBool(allow)
+	if err != nil {
+		panic("env variable WEBHOOK_ALLOW_PRIVATE must be true or false")
+	}
+	return value
+}
+
 func getMongo() *mongo.Client {
 	mongourl, ok := os.LookupEnv("MONGO_URL")
 	if !ok {
@@ -45,18 +100,41 @@ func getMongo() *mongo.Client {
 	return client
 }
 
+// getStore returns the in-memory store when STORAGE=memory, and connects to MongoDB otherwise.
+// The returned function must be called on shutdown.
+func getStore() (store.Store, func()) {
+	if os.Getenv("STORAGE") == "memory" {
+		return store.NewMemory(), func() {}
+	}
+
+	db := getMongo()
+	s := store.NewMongo(db)
+	if err := s.EnsureIndexes(context.TODO()); err != nil {
+		panic(err)
+	}
+	return s, func() {
+		if err := db.Disconnect(context.TODO()); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // @title           Triplan API
 // @version         1.0
 // @description     Triplan API POC
 // @license.name	Unlicense
 func main() {
-	db := getMongo()
-	defer func() {
-		if err := db.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
-	routes := api.New(db)
+	s, closeStore := getStore()
+	defer closeStore()
+	routes := api.New(s)
+	if getWebhookAllowPrivate() {
+		routes.AllowPrivateWebhooks()
+	}
+	go routes.RunTrashPurge(context.Background(), time.Hour, getTrashRetention())
+	go routes.RunIdempotencyCleanup(context.Background(), time.Hour)
+	go routes.RunRecurringTransactions(context.Background(), time.Minute)
+	go routes.RunWebhookDeliveries(context.Background(), 5*time.Second, getWebhookRetryDelay())
+	go routes.RunWebhookDeliveryPurge(context.Background(), time.Hour, getWebhookDeliveryRetention())
 
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
@@ -69,32 +147,80 @@ func main() {
 			return ctx.Status(code).JSON(fiber.Map{"error": err.Error()})
 		},
 	})
-	app.Use(cors.New())
+	// clients need the ETag to send it back in If-Match, and to know when a response was replayed
+	app.Use(cors.New(cors.Config{ExposeHeaders: fiber.HeaderETag + ", Idempotent-Replayed"}))
 
 	app.Get("/", routes.HomeStats)
 	app.Get("/doc/*", swagger.HandlerDefault)
-	users := app.Group("/users")
+	auth := app.Group("/auth")
+	auth.Post("/signup", routes.Signup)
+	auth.Post("/login", routes.Login)
+	auth.Post("/logout", routes.Authenticate, routes.Logout)
+	auth.Get("/me", routes.Authenticate, routes.GetMe)
+
+	users := app.Group("/users", routes.Authenticate)
 	users.Get("", routes.GetUsers)
 	users.Get("/:id", routes.GetUserInfo)
-	users.Post("", routes.PostUser)
+	users.Get("/:id/summary", routes.GetUserSummary)
+	users.Post("", routes.Idempotent, routes.PostUser)
 	users.Delete("/:id", routes.DeleteUser)
 	users.Put("/:id", routes.PutUser)
+	users.Patch("/:id", routes.PatchUser)
 
-	groups := app.Group("/groups")
+	groups := app.Group("/groups", routes.Authenticate)
+	groups.Post("/join/:token", routes.JoinGroup)
 	groups.Get("", routes.GetGroups)
+	groups.Get("/trash", routes.GetTrashedGroups)
+	groups.Post("/restore", routes.RestoreGroupBackup)
 	groups.Get("/:id/users", routes.GetUsersFromGroup)
 	groups.Get("/:id/balances", routes.GetGroupBalances)
+	groups.Get("/:id/balances.csv", routes.ExportGroupBalances)
+	groups.Get("/:id/settlements", routes.GetGroupSettlements)
+	groups.Get("/:id/stats", routes.GetGroupStats)
+	groups.Get("/:id/budget", routes.GetGroupBudget)
+	groups.Get("/:id/backup", routes.GetGroupBackup)
 	groups.Get("/:id", routes.GetGroupInfo)
-	groups.Post("", routes.PostGroup)
+	groups.Post("", routes.Idempotent, routes.PostGroup)
 	groups.Delete("/:id", routes.DeleteGroup)
 	groups.Put("/:id", routes.PutGroup)
+	groups.Patch("/:id", routes.PatchGroup)
+	groups.Post("/:id/restore", routes.RestoreGroup)
+	groups.Get("/:id/trash", routes.GetGroupTrash)
+	groups.Get("/:id/activity", routes.GetGroupActivity)
+	groups.Get("/:id/events", routes.GetGroupEvents)
+	groups.Post("/:id/members", routes.PostGroupMember)
+	groups.Delete("/:id/members/:userId", routes.DeleteGroupMember)
+	groups.Get("/:id/invitations", routes.GetGroupInvitations)
+	groups.Post("/:id/invitations", routes.PostGroupInvitation)
+	groups.Delete("/:id/invitations/:invitationId", routes.DeleteGroupInvitation)
 
 	groups.Get("/:id/transactions", routes.GetGroupTransactions)
-	groups.Post("/:id/transactions", routes.PostGroupTransaction)
-	transactions := app.Group("/transactions")
+	groups.Post("/:id/transactions", routes.Idempotent, routes.PostGroupTransaction)
+	groups.Get("/:id/transactions/search", routes.SearchGroupTransactions)
+	groups.Get("/:id/export.csv", routes.ExportGroupTransactions)
+	groups.Post("/:id/import", routes.Idempotent, routes.ImportGroupTransactions)
+	groups.Get("/:id/recurring", routes.GetGroupRecurringTransactions)
+	groups.Post("/:id/recurring", routes.PostGroupRecurringTransaction)
+	groups.Get("/:id/webhooks", routes.GetGroupWebhooks)
+	groups.Post("/:id/webhooks", routes.PostGroupWebhook)
+	transactions := app.Group("/transactions", routes.Authenticate)
 	transactions.Delete("/:id", routes.DeleteTransaction)
 	transactions.Put("/:id", routes.PutTransaction)
+	transactions.Patch("/:id", routes.PatchTransaction)
 	transactions.Get("/:id", routes.GetTransaction)
+	transactions.Post("/:id/restore", routes.RestoreTransaction)
+	transactions.Get("/:id/history", routes.GetTransactionHistory)
+	recurring := app.Group("/recurring", routes.Authenticate)
+	recurring.Get("/:id", routes.GetRecurringTransaction)
+	recurring.Put("/:id", routes.PutRecurringTransaction)
+	recurring.Delete("/:id", routes.DeleteRecurringTransaction)
+	recurring.Post("/:id/skip", routes.SkipRecurringOccurrence)
+	webhooks := app.Group("/webhooks", routes.Authenticate)
+	webhooks.Get("/:id", routes.GetWebhook)
+	webhooks.Put("/:id", routes.PutWebhook)
+	webhooks.Delete("/:id", routes.DeleteWebhook)
+	webhooks.Get("/:id/deliveries", routes.GetWebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:deliveryId/replay", routes.ReplayWebhookDelivery)
 
 	app.Listen("0.0.0.0" + getPort())
 }
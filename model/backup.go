@@ -0,0 +1,148 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackupVersion is the version of the archives made by GET /groups/{id}/backup, it changes with their format
+const BackupVersion = 1
+
+// GroupBackup is an archive of a group, of its transactions, including those in the trash, and of the users they refer to
+type GroupBackup struct {
+	Version      int           `json:"version"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	Group        Group         `json:"group"`
+	Users        []User        `json:"users"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// UserIds returns the users the group and its transactions refer to
+func (b *GroupBackup) UserIds() []primitive.ObjectID {
+	seen := map[primitive.ObjectID]bool{}
+	userIds := []primitive.ObjectID{}
+	add := func(userId primitive.ObjectID) {
+		if !seen[userId] {
+			seen[userId] = true
+			userIds = append(userIds, userId)
+		}
+	}
+	for _, userId := range b.Group.Users {
+		add(userId)
+	}
+	for _, userId := range b.Group.FormerUsers {
+		add(userId)
+	}
+	for _, transaction := range b.Transactions {
+		for _, userId := range transaction.Users() {
+			add(userId)
+		}
+	}
+	return userIds
+}
+
+// Validate checks that the archive can be restored, the group itself is validated like any group
+func (b *GroupBackup) Validate() error {
+	if b.Version != BackupVersion {
+		return fmt.Errorf(`field "version" must be %d, archives of other versions can not be restored`, BackupVersion)
+	}
+	if b.Group.Id.IsZero() {
+		return fmt.Errorf(`field "group.id" must be filled`)
+	}
+
+	users := map[primitive.ObjectID]bool{}
+	for _, user := range b.Users {
+		if user.Id.IsZero() {
+			return fmt.Errorf(`field "users" must only have users with an id`)
+		}
+		users[user.Id] = true
+	}
+	for _, userId := range b.UserIds() {
+		if !users[userId] {
+			return fmt.Errorf(`field "users" must have every user of the group and of its transactions, "%s" is missing`, userId.Hex())
+		}
+	}
+
+	// users who left the group can still appear in its transactions
+	inGroup := map[primitive.ObjectID]bool{}
+	for _, userId := range append(append([]primitive.ObjectID{}, b.Group.Users...), b.Group.FormerUsers...) {
+		inGroup[userId] = true
+	}
+	seen := map[primitive.ObjectID]bool{}
+	for i := range b.Transactions {
+		transaction := &b.Transactions[i]
+		if transaction.Id.IsZero() || seen[transaction.Id] {
+			return fmt.Errorf(`field "transactions" must only have transactions with a distinct id`)
+		}
+		seen[transaction.Id] = true
+		if transaction.Group != b.Group.Id {
+			return fmt.Errorf(`transaction "%s": field "group" must be the id of the group`, transaction.Id.Hex())
+		}
+		if err := transaction.Validate(); err != nil {
+			return fmt.Errorf(`transaction "%s": %w`, transaction.Id.Hex(), err)
+		}
+		for _, userId := range transaction.Users() {
+			if !inGroup[userId] {
+				return fmt.Errorf(`transaction "%s": users must be members or former members of the group`, transaction.Id.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// WithFreshIds returns a copy of the archive where the group and its transactions have new ids, users keep theirs
+func (b *GroupBackup) WithFreshIds() GroupBackup {
+	fresh := *b
+	fresh.Group.Id = primitive.NewObjectID()
+	fresh.Transactions = make([]Transaction, len(b.Transactions))
+	for i, transaction := range b.Transactions {
+		transaction.Id = primitive.NewObjectID()
+		transaction.Group = fresh.Group.Id
+		fresh.Transactions[i] = transaction
+	}
+	return fresh
+}
+
+// WithUsers returns a copy of the archive without the users keep refuses, nor the transactions they appear in
+func (b *GroupBackup) WithUsers(keep func(userId primitive.ObjectID) bool) GroupBackup {
+	kept := *b
+	kept.Users = []User{}
+	for _, user := range b.Users {
+		if keep(user.Id) {
+			kept.Users = append(kept.Users, user)
+		}
+	}
+	kept.Group.Users = []primitive.ObjectID{}
+	for _, userId := range b.Group.Users {
+		if keep(userId) {
+			kept.Group.Users = append(kept.Group.Users, userId)
+		}
+	}
+	kept.Group.FormerUsers = []primitive.ObjectID{}
+	for _, userId := range b.Group.FormerUsers {
+		if keep(userId) {
+			kept.Group.FormerUsers = append(kept.Group.FormerUsers, userId)
+		}
+	}
+	kept.Group.Roles = []GroupRole{}
+	for _, role := range b.Group.Roles {
+		if keep(role.User) {
+			kept.Group.Roles = append(kept.Group.Roles, role)
+		}
+	}
+	kept.Transactions = []Transaction{}
+	for _, transaction := range b.Transactions {
+		keepTransaction := true
+		for _, userId := range transaction.Users() {
+			if !keep(userId) {
+				keepTransaction = false
+			}
+		}
+		if keepTransaction {
+			kept.Transactions = append(kept.Transactions, transaction)
+		}
+	}
+	return kept
+}
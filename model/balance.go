@@ -1,7 +1,54 @@
 package model
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
 type Balance struct {
 	PositiveAmount uint32 `json:"positiveAmount"`
 	NegativeAmount uint32 `json:"negativeAmount"`
 	TotalAmount    int32  `json:"totalAmount"`
 }
+
+// balanceOf returns the balance of a user, creating it for users that are no longer members of the group
+func balanceOf(balanceMap map[primitive.ObjectID]*Balance, userId primitive.ObjectID) *Balance {
+	balance, ok := balanceMap[userId]
+	if !ok {
+		balance = &Balance{}
+		balanceMap[userId] = balance
+	}
+	return balance
+}
+
+// ComputeBalances returns the balance of every given user over the given transactions, in the group currency.
+// Users appearing in the transactions without being given, like former members, get a balance too.
+func ComputeBalances(users []primitive.ObjectID, transactions []Transaction) (map[primitive.ObjectID]*Balance, error) {
+	balanceMap := make(map[primitive.ObjectID]*Balance)
+	for _, userId := range users {
+		balanceMap[userId] = &Balance{
+			PositiveAmount: 0,
+			NegativeAmount: 0,
+			TotalAmount:    0,
+		}
+	}
+
+	for _, transaction := range transactions {
+		err := transaction.ComputePrices()
+		if err != nil {
+			return nil, err
+		}
+		payer := transaction.PaidBy
+		balanceOf(balanceMap, payer).PositiveAmount += transaction.InGroupCurrency(transaction.Amount)
+
+		for _, target := range transaction.PaidFor {
+			balanceOf(balanceMap, target.User).NegativeAmount += transaction.InGroupCurrency(target.ComputedPrice)
+		}
+
+	}
+
+	for _, balance := range balanceMap {
+		balance.TotalAmount = int32(
+			balance.PositiveAmount - balance.NegativeAmount,
+		)
+	}
+
+	return balanceMap, nil
+}
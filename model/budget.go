@@ -0,0 +1,143 @@
+package model
+
+import (
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Budget limits the expenses of a group, in the group currency. Zero limits are unlimited.
+type Budget struct {
+	Total uint32 `json:"total,omitempty" bson:"total,omitempty"`
+	// Categories limits the expenses of each category
+	Categories map[string]uint32 `json:"categories,omitempty" bson:"categories,omitempty"`
+	// PerPerson limits the share of each member in the expenses
+	PerPerson uint32 `json:"perPerson,omitempty" bson:"perPerson,omitempty"`
+}
+
+func (b *Budget) Validate() error {
+	for category := range b.Categories {
+		if category == "" {
+			return errors.New(`field "budget.categories" must only have non-empty categories`)
+		}
+	}
+	return nil
+}
+
+// BudgetLine compares a limit of a budget to what was spent, Remaining is negative when the limit is exceeded
+type BudgetLine struct {
+	Limit     uint32 `json:"limit"`
+	Spent     int64  `json:"spent"`
+	Remaining int64  `json:"remaining"`
+	Over      bool   `json:"over"`
+}
+
+func newBudgetLine(limit uint32, spent int64) BudgetLine {
+	return BudgetLine{
+		Limit:     limit,
+		Spent:     spent,
+		Remaining: int64(limit) - spent,
+		Over:      spent > int64(limit),
+	}
+}
+
+type CategoryBudget struct {
+	Category string `json:"category"`
+	BudgetLine
+}
+
+type PersonBudget struct {
+	User primitive.ObjectID `json:"user"`
+	BudgetLine
+}
+
+// BudgetReport compares the budget of a group to its expenses, only the limits set in the budget are reported
+type BudgetReport struct {
+	Currency   string           `json:"currency,omitempty"`
+	Total      *BudgetLine      `json:"total,omitempty"`
+	Categories []CategoryBudget `json:"categories"`
+	PerPerson  []PersonBudget   `json:"perPerson"`
+}
+
+// Report compares the budget to the stats of the given members of a group
+func (b *Budget) Report(currency string, stats GroupStats, members []primitive.ObjectID) BudgetReport {
+	report := BudgetReport{
+		Currency:   currency,
+		Categories: []CategoryBudget{},
+		PerPerson:  []PersonBudget{},
+	}
+	if b.Total != 0 {
+		line := newBudgetLine(b.Total, stats.Total)
+		report.Total = &line
+	}
+
+	spent := map[string]int64{}
+	for _, category := range stats.ByCategory {
+		spent[category.Category] = category.Total
+	}
+	for category, limit := range b.Categories {
+		if limit != 0 {
+			report.Categories = append(report.Categories, CategoryBudget{category, newBudgetLine(limit, spent[category])})
+		}
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Category < report.Categories[j].Category
+	})
+
+	if b.PerPerson != 0 {
+		shares := map[primitive.ObjectID]int64{}
+		for _, participant := range stats.ByParticipant {
+			shares[participant.User] = participant.Total
+		}
+		for _, userId := range members {
+			report.PerPerson = append(report.PerPerson, PersonBudget{userId, newBudgetLine(b.PerPerson, shares[userId])})
+		}
+	}
+
+	return report
+}
+
+// pushedOver reports whether the line is exceeded because of the last share that was spent
+func (l *BudgetLine) pushedOver(share int64) bool {
+	return l.Over && l.Spent-share <= int64(l.Limit)
+}
+
+// Exceeded returns the limits of the report that the transaction, the last one counted in the report, pushed over,
+// and whether there are any. The limits that were already exceeded before the transaction are left out.
+func (r *BudgetReport) Exceeded(transaction *Transaction) (BudgetReport, bool) {
+	exceeded := BudgetReport{
+		Currency:   r.Currency,
+		Categories: []CategoryBudget{},
+		PerPerson:  []PersonBudget{},
+	}
+	if transaction.GetKind() != KindExpense {
+		return exceeded, false
+	}
+
+	// the shares of the transaction, as they are counted in the stats
+	amount := int64(transaction.InGroupCurrency(transaction.Amount))
+	shares := map[primitive.ObjectID]int64{}
+	for _, target := range transaction.PaidFor {
+		shares[target.User] += int64(transaction.InGroupCurrency(target.ComputedPrice))
+	}
+
+	found := false
+	if r.Total != nil && r.Total.pushedOver(amount) {
+		exceeded.Total = r.Total
+		found = true
+	}
+	for _, category := range r.Categories {
+		if category.Category == transaction.Category && category.pushedOver(amount) {
+			exceeded.Categories = append(exceeded.Categories, category)
+			found = true
+		}
+	}
+	for _, person := range r.PerPerson {
+		if share, ok := shares[person.User]; ok && person.pushedOver(share) {
+			exceeded.PerPerson = append(exceeded.PerPerson, person)
+			found = true
+		}
+	}
+	return exceeded, found
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBudgetExceeded(t *testing.T) {
+	budget := Budget{Total: 200, Categories: map[string]uint32{"food": 100, "travel": 50}, PerPerson: 60}
+	members := []primitive.ObjectID{ann, bob}
+	tests := []struct {
+		name string
+		// before are the expenses added before the transaction
+		before      []Transaction
+		transaction Transaction
+		total       bool
+		categories  []string
+		perPerson   []primitive.ObjectID
+	}{
+		{
+			name:        "within every limit",
+			transaction: expense(ann, 80, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}),
+		},
+		{
+			name:        "pushed over the category and the shares",
+			transaction: expense(ann, 150, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}),
+			categories:  []string{"food"},
+			perPerson:   []primitive.ObjectID{ann, bob},
+		},
+		{
+			name:        "limits exceeded before are left out",
+			before:      []Transaction{expense(ann, 150, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1})},
+			transaction: expense(bob, 10, &TransactionTarget{User: bob, Weight: 1}),
+		},
+		{
+			name:        "pushed over the total only",
+			before:      []Transaction{expense(ann, 150, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1})},
+			transaction: expense(bob, 60, &TransactionTarget{User: bob, Weight: 1}),
+			total:       true,
+		},
+		{
+			name:        "reaching a limit does not exceed it",
+			transaction: expense(ann, 100, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}),
+		},
+		{
+			name:        "transfers are not expenses",
+			before:      []Transaction{expense(ann, 150, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1})},
+			transaction: transfer(bob, ann, 500),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactions := append(test.before, test.transaction)
+			// prices are computed when transactions are saved
+			for i := range transactions {
+				transactions[i].Id = primitive.NewObjectID()
+				if err := transactions[i].ComputePrices(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stats := ComputeGroupStats(transactions, 0)
+			transaction := transactions[len(transactions)-1]
+			report := budget.Report("EUR", stats, members)
+
+			exceeded, found := report.Exceeded(&transaction)
+			if found != (test.total || len(test.categories) != 0 || len(test.perPerson) != 0) {
+				t.Errorf("found = %v with %+v", found, exceeded)
+			}
+			if (exceeded.Total != nil) != test.total {
+				t.Errorf("total exceeded = %v, want %v", exceeded.Total != nil, test.total)
+			}
+			categories := []string{}
+			for _, category := range exceeded.Categories {
+				categories = append(categories, category.Category)
+			}
+			if len(categories) != len(test.categories) || (len(categories) != 0 && categories[0] != test.categories[0]) {
+				t.Errorf("categories = %v, want %v", categories, test.categories)
+			}
+			perPerson := map[primitive.ObjectID]bool{}
+			for _, person := range exceeded.PerPerson {
+				perPerson[person.User] = true
+			}
+			if len(perPerson) != len(test.perPerson) {
+				t.Errorf("per person = %v, want %v", exceeded.PerPerson, test.perPerson)
+			}
+			for _, user := range test.perPerson {
+				if !perPerson[user] {
+					t.Errorf("the share of %s is not exceeded", user.Hex())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventType string
+
+const (
+	EventTransactionCreated  EventType = "transaction.created"
+	EventTransactionUpdated  EventType = "transaction.updated"
+	EventTransactionDeleted  EventType = "transaction.deleted"
+	EventTransactionRestored EventType = "transaction.restored"
+	EventGroupCreated        EventType = "group.created"
+	EventGroupUpdated        EventType = "group.updated"
+	EventGroupDeleted        EventType = "group.deleted"
+	EventGroupRestored       EventType = "group.restored"
+	// EventMembersChanged is a change of the group that adds or removes members
+	EventMembersChanged EventType = "members.changed"
+)
+
+var eventTypes = map[HistoryEntity]map[HistoryAction]EventType{
+	EntityTransaction: {
+		ActionCreate:  EventTransactionCreated,
+		ActionUpdate:  EventTransactionUpdated,
+		ActionDelete:  EventTransactionDeleted,
+		ActionRestore: EventTransactionRestored,
+	},
+	EntityGroup: {
+		ActionCreate:  EventGroupCreated,
+		ActionUpdate:  EventGroupUpdated,
+		ActionDelete:  EventGroupDeleted,
+		ActionRestore: EventGroupRestored,
+	},
+}
+
+// Event tells the members of a group about a change, it has the id of the history entry of the change
+type Event struct {
+	Id       primitive.ObjectID `json:"id" bson:"id"`
+	Type     EventType          `json:"type" bson:"type"`
+	Group    primitive.ObjectID `json:"group" bson:"group"`
+	EntityId primitive.ObjectID `json:"entityId" bson:"entityId"`
+	Actor    primitive.ObjectID `json:"actor" bson:"actor"`
+	Time     time.Time          `json:"time" bson:"time"`
+	Changes  []FieldChange      `json:"changes" bson:"changes"`
+}
+
+// NewEvent returns the event of the change recorded by a history entry
+func NewEvent(entry *HistoryEntry) Event {
+	eventType := eventTypes[entry.Entity][entry.Action]
+	if eventType == EventGroupUpdated {
+		for _, change := range entry.Changes {
+			if change.Field == "users" {
+				eventType = EventMembersChanged
+			}
+		}
+	}
+	return Event{
+		Id:       entry.Id,
+		Type:     eventType,
+		Group:    entry.Group,
+		EntityId: entry.EntityId,
+		Actor:    entry.Actor,
+		Time:     entry.Time,
+		Changes:  entry.Changes,
+	}
+}
@@ -1,10 +1,129 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var currencyCodeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// IsCurrencyCode reports whether code looks like an ISO 4217 currency code, like "EUR"
+func IsCurrencyCode(code string) bool {
+	return currencyCodeRegexp.MatchString(code)
+}
+
+type Role string
+
+const (
+	// RoleOwner can do everything on the group, including deleting it and changing roles
+	RoleOwner Role = "owner"
+	// RoleAdmin can update the group
+	RoleAdmin Role = "admin"
+	// RoleMember can read the group and manage its transactions
+	RoleMember Role = "member"
+)
+
+var roleRanks = map[Role]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// AtLeast reports whether r grants every permission of other
+func (r Role) AtLeast(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+type GroupRole struct {
+	User primitive.ObjectID `json:"user" bson:"user"`
+	Role Role               `json:"role" bson:"role"`
+}
 
 type Group struct {
 	Id          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	Name        string               `json:"name,omitempty" bson:"name,omitempty"`
 	Description string               `json:"description,omitempty" bson:"description,omitempty"`
 	Users       []primitive.ObjectID `json:"users,omitempty" bson:"users,omitempty"`
+	// FormerUsers left the group but still appear in some of its transactions
+	FormerUsers []primitive.ObjectID `json:"formerUsers,omitempty" bson:"formerUsers,omitempty"`
+	// Currency is the currency balances are computed in
+	Currency string `json:"currency,omitempty" bson:"currency,omitempty"`
+	// ExchangeRates gives the value of one unit of each currency in the group currency,
+	// used for transactions that do not carry their own rate
+	ExchangeRates map[string]float64 `json:"exchangeRates,omitempty" bson:"exchangeRates,omitempty"`
+	// Roles of the members, members without a role are RoleMember
+	Roles []GroupRole `json:"roles,omitempty" bson:"roles,omitempty"`
+	// Budget is optional, see GET /groups/{id}/budget
+	Budget *Budget `json:"budget,omitempty" bson:"budget,omitempty"`
+	// DeletedAt is set when the group is in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Version is incremented by every change to the group, it is sent as the ETag of the group
+	Version uint32 `json:"version" bson:"version"`
+}
+
+func (g *Group) HasMember(userId primitive.ObjectID) bool {
+	for _, id := range g.Users {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOf returns the role of a user in the group, or an empty role if the user is not a member.
+// Groups created before roles existed have no owner, all their members are owners.
+func (g *Group) RoleOf(userId primitive.ObjectID) Role {
+	if !g.HasMember(userId) {
+		return ""
+	}
+	if len(g.Roles) == 0 {
+		return RoleOwner
+	}
+	for _, role := range g.Roles {
+		if role.User == userId {
+			return role.Role
+		}
+	}
+	return RoleMember
+}
+
+// ValidateRoles checks that roles are valid, only given to members, and that the group has an owner
+func (g *Group) ValidateRoles() error {
+	hasOwner := false
+	seen := map[primitive.ObjectID]bool{}
+	for _, role := range g.Roles {
+		if _, ok := roleRanks[role.Role]; !ok {
+			return fmt.Errorf(`field "roles" must only have roles "%s", "%s" or "%s"`, RoleOwner, RoleAdmin, RoleMember)
+		}
+		if !g.HasMember(role.User) {
+			return fmt.Errorf(`field "roles" must only have roles of members of the group`)
+		}
+		if seen[role.User] {
+			return fmt.Errorf(`field "roles" must have at most one role per user`)
+		}
+		seen[role.User] = true
+		hasOwner = hasOwner || role.Role == RoleOwner
+	}
+	if !hasOwner {
+		return fmt.Errorf(`field "roles" must have at least one owner`)
+	}
+	return nil
+}
+
+func (g *Group) ValidateCurrencies() error {
+	if g.Currency != "" && !IsCurrencyCode(g.Currency) {
+		return fmt.Errorf(`field "currency" must be a 3 letters currency code`)
+	}
+	for code, rate := range g.ExchangeRates {
+		if !IsCurrencyCode(code) {
+			return fmt.Errorf(`field "exchangeRates" must be indexed by 3 letters currency codes, got "%s"`, code)
+		}
+		if rate <= 0 {
+			return fmt.Errorf(`field "exchangeRates" must only have positive rates, got %v for "%s"`, rate, code)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type HistoryAction string
+
+const (
+	ActionCreate  HistoryAction = "create"
+	ActionUpdate  HistoryAction = "update"
+	ActionDelete  HistoryAction = "delete"
+	ActionRestore HistoryAction = "restore"
+)
+
+type HistoryEntity string
+
+const (
+	EntityGroup       HistoryEntity = "group"
+	EntityTransaction HistoryEntity = "transaction"
+)
+
+// FieldChange is the change of a single JSON field of an entity.
+// Values are kept as JSON so that they are sent back exactly as the entity was.
+type FieldChange struct {
+	Field  string          `json:"field" bson:"field"`
+	Before json.RawMessage `json:"before,omitempty" bson:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// HistoryEntry records a change made by a user, entries are never updated nor deleted
+type HistoryEntry struct {
+	Id       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Entity   HistoryEntity      `json:"entity" bson:"entity"`
+	EntityId primitive.ObjectID `json:"entityId" bson:"entityId"`
+	// Group is the group the entity belongs to, or the group itself
+	Group   primitive.ObjectID `json:"group" bson:"group"`
+	Action  HistoryAction      `json:"action" bson:"action"`
+	Actor   primitive.ObjectID `json:"actor" bson:"actor"`
+	Time    time.Time          `json:"time" bson:"time"`
+	Changes []FieldChange      `json:"changes" bson:"changes"`
+}
+
+// jsonFields returns the fields of v as they are sent to clients
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
+
+// Diff returns the JSON fields that differ between before and after, sorted by name.
+// Both must be pointers, a nil before or after stands for a created or removed entity.
+func Diff(before any, after any) ([]FieldChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range beforeFields {
+		names[name] = true
+	}
+	for name := range afterFields {
+		names[name] = true
+	}
+
+	changes := []FieldChange{}
+	for name := range names {
+		if !bytes.Equal(beforeFields[name], afterFields[name]) {
+			changes = append(changes, FieldChange{
+				Field:  name,
+				Before: beforeFields[name],
+				After:  afterFields[name],
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// LastState decodes into v the entity as it was after the newest of entries, which are its whole history, newest first
+func LastState(entries []HistoryEntry, v any) error {
+	fields := map[string]json.RawMessage{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			if seen[change.Field] {
+				continue
+			}
+			seen[change.Field] = true
+			// removed fields have no value after the change
+			if change.After != nil {
+				fields[change.Field] = change.After
+			}
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// IdempotentRequest remembers the response to a request sent with an Idempotency-Key header,
+// so that the request is not applied twice when the client retries it
+type IdempotentRequest struct {
+	// Key is the key sent by the client, prefixed by the id of its user
+	Key string `json:"key" bson:"_id"`
+	// Fingerprint identifies the request the key was first used for
+	Fingerprint string `json:"fingerprint" bson:"fingerprint"`
+	// Completed is false while the first request is being processed
+	Completed   bool      `json:"completed" bson:"completed"`
+	Status      int       `json:"status,omitempty" bson:"status,omitempty"`
+	ContentType string    `json:"contentType,omitempty" bson:"contentType,omitempty"`
+	ETag        string    `json:"etag,omitempty" bson:"etag,omitempty"`
+	Body        []byte    `json:"body,omitempty" bson:"body,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+func (r *IdempotentRequest) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
@@ -0,0 +1,414 @@
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImportFormat string
+
+const (
+	// ImportSplitwise reads the "Export as spreadsheet" file of a Splitwise group
+	ImportSplitwise ImportFormat = "splitwise"
+	// ImportTricount reads the CSV export of a tricount
+	ImportTricount ImportFormat = "tricount"
+)
+
+// ImportCategory is the category of imported expenses that have none
+const ImportCategory = "imported"
+
+// ImportLine is the transaction read from a line of an imported file, or the reason it was rejected
+type ImportLine struct {
+	// Line is the number of the line in the file, the header being line 1
+	Line        int          `json:"line"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// ImportReport lists the lines of an imported file that are accepted and the ones that are rejected
+type ImportReport struct {
+	// DryRun is true when the accepted transactions were not created
+	DryRun   bool         `json:"dryRun"`
+	Accepted []ImportLine `json:"accepted"`
+	Rejected []ImportLine `json:"rejected"`
+	// UnknownNames are the names of the file that are not mapped to a member
+	UnknownNames []string `json:"unknownNames"`
+}
+
+// importer reads the lines of a file with the given header, users are resolved from their name in the file
+type importer struct {
+	columns map[string]int
+	// members are the names of the header that are members, by column
+	members map[int]string
+	resolve func(name string) (primitive.ObjectID, bool)
+	unknown map[string]bool
+	// currency is the currency of the group, defaultCurrency the one the amounts in default currency of the file are in
+	currency        string
+	defaultCurrency string
+}
+
+// ParseImport reads the transactions of a CSV file exported by another application into a group with the given currency.
+// resolve returns the user of a name of the file. The transactions have no group yet and are not validated.
+func ParseImport(format ImportFormat, data io.Reader, currency string, resolve func(name string) (primitive.ObjectID, bool)) (ImportReport, error) {
+	report := ImportReport{Accepted: []ImportLine{}, Rejected: []ImportLine{}, UnknownNames: []string{}}
+
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return report, errors.New("the file is empty")
+	}
+	if err != nil {
+		return report, err
+	}
+	if len(header) > 0 {
+		// spreadsheets often start their CSV files with a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	imp := &importer{columns: map[string]int{}, members: map[int]string{}, resolve: resolve, unknown: map[string]bool{}, currency: currency}
+	var parse func(record []string) (*Transaction, error)
+	switch format {
+	case ImportSplitwise:
+		err = imp.splitwiseHeader(header)
+		parse = imp.splitwise
+	case ImportTricount:
+		err = imp.tricountHeader(header)
+		parse = imp.tricount
+	default:
+		return report, fmt.Errorf(`field "format" must be either "%s" or "%s"`, ImportSplitwise, ImportTricount)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		// the reader skips empty lines, Splitwise leaves one after the header
+		line, _ := reader.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+		transaction, err := parse(record)
+		if err != nil {
+			report.Rejected = append(report.Rejected, ImportLine{Line: line, Error: err.Error()})
+			continue
+		}
+		if transaction != nil {
+			report.Accepted = append(report.Accepted, ImportLine{Line: line, Transaction: transaction})
+		}
+	}
+
+	for name := range imp.unknown {
+		report.UnknownNames = append(report.UnknownNames, name)
+	}
+	sort.Strings(report.UnknownNames)
+	return report, nil
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readHeader indexes the columns of header, which must have the required ones, case-insensitively
+func (imp *importer) readHeader(header []string, required ...string) error {
+	for i, name := range header {
+		imp.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := imp.columns[name]; !ok {
+			return fmt.Errorf(`the header of the file must have a "%s" column`, name)
+		}
+	}
+	return nil
+}
+
+// field returns the value of a column of record, empty when the file has no such column
+func (imp *importer) field(record []string, column string) string {
+	i, ok := imp.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// user resolves a name of the file, remembering the names that are not mapped
+func (imp *importer) user(name string) (primitive.ObjectID, error) {
+	userId, ok := imp.resolve(name)
+	if !ok {
+		imp.unknown[name] = true
+		return userId, fmt.Errorf(`"%s" is not mapped to a member of the group`, name)
+	}
+	return userId, nil
+}
+
+// parseCents reads a decimal amount like "-12.50" or "12,5" in hundredths
+func parseCents(value string) (int64, error) {
+	amount, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", ".", 1), 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) || math.Abs(amount) > math.MaxUint32/100 {
+		return 0, fmt.Errorf(`"%s" is not an amount`, value)
+	}
+	return int64(math.Round(amount * 100)), nil
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "02/01/2006 15:04", "02/01/2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`"%s" is not a date`, value)
+}
+
+// splitwiseHeader reads a header like "Date,Description,Category,Cost,Currency,Alice,Bob", the members come last
+func (imp *importer) splitwiseHeader(header []string) error {
+	if err := imp.readHeader(header, "date", "description", "category", "cost", "currency"); err != nil {
+		return err
+	}
+	for i, name := range header {
+		if i > imp.columns["currency"] && strings.TrimSpace(name) != "" {
+			imp.members[i] = strings.TrimSpace(name)
+		}
+	}
+	return nil
+}
+
+// splitwise reads a line whose member columns are what each member paid minus their share.
+// The "Total balance" line ends the file, it is not a transaction.
+func (imp *importer) splitwise(record []string) (*Transaction, error) {
+	if strings.EqualFold(imp.field(record, "description"), "Total balance") {
+		return nil, nil
+	}
+	date, err := parseImportDate(imp.field(record, "date"))
+	if err != nil {
+		return nil, err
+	}
+	cost, err := parseCents(imp.field(record, "cost"))
+	if err != nil {
+		return nil, err
+	}
+	if cost <= 0 {
+		return nil, errors.New("the cost must be positive")
+	}
+
+	payer, nets := "", map[string]int64{}
+	for i, name := range imp.members {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		net, err := parseCents(record[i])
+		if err != nil {
+			return nil, err
+		}
+		if net == 0 {
+			continue
+		}
+		nets[name] = net
+		if net > 0 {
+			if payer != "" {
+				return nil, errors.New("transactions paid by several members can not be imported")
+			}
+			payer = name
+		}
+	}
+	if payer == "" {
+		return nil, errors.New("the transaction has no payer")
+	}
+
+	transaction := &Transaction{
+		Amount:   uint32(cost),
+		Date:     date,
+		Category: imp.field(record, "category"),
+		Title:    imp.field(record, "description"),
+		Currency: imp.field(record, "currency"),
+	}
+	if transaction.PaidBy, err = imp.user(payer); err != nil {
+		return nil, err
+	}
+	// what the payer paid for themselves is not part of their net amount
+	shares := map[string]int64{payer: cost - nets[payer]}
+	for name, net := range nets {
+		if net < 0 {
+			shares[name] = -net
+		}
+	}
+
+	if strings.EqualFold(transaction.Category, "Payment") {
+		transaction.Kind = KindTransfer
+		transaction.Category = ""
+		delete(shares, payer)
+	} else if transaction.Category == "" {
+		transaction.Category = ImportCategory
+	}
+	if err := imp.addShares(transaction, shares, cost); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// tricountMemberPrefixes start the names of the columns holding the share of each member
+var tricountMemberPrefixes = []string{"impacted to ", "paid to "}
+
+// tricountDefaultAmount starts the name of the column holding the amounts in the default currency of the tricount,
+// which follows it in parentheses
+const tricountDefaultAmount = "amount in default currency"
+
+// tricountHeader reads a header like "Title,Amount,Currency,Exchange rate,Amount in default currency (EUR),Date,
+// Transaction type,Paid by,Impacted to Alice,Impacted to Bob"
+func (imp *importer) tricountHeader(header []string) error {
+	if err := imp.readHeader(header, "title", "amount", "paid by"); err != nil {
+		return err
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if strings.HasPrefix(name, tricountDefaultAmount) {
+			imp.columns[tricountDefaultAmount] = i
+			currency := strings.Trim(strings.TrimSpace(strings.TrimPrefix(name, tricountDefaultAmount)), "()")
+			imp.defaultCurrency = strings.ToUpper(currency)
+		}
+	}
+	if _, ok := imp.columns["date"]; !ok {
+		if i, ok := imp.columns["date & time"]; ok {
+			imp.columns["date"] = i
+		} else {
+			return errors.New(`the header of the file must have a "date" column`)
+		}
+	}
+	for i, name := range header {
+		for _, prefix := range tricountMemberPrefixes {
+			if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				imp.members[i] = strings.TrimSpace(name[len(prefix):])
+			}
+		}
+	}
+	if len(imp.members) == 0 {
+		return errors.New(`the header of the file must have an "Impacted to" column per member`)
+	}
+	return nil
+}
+
+// tricount reads a line whose member columns are the share of each member, in the currency of the line
+func (imp *importer) tricount(record []string) (*Transaction, error) {
+	date, err := parseImportDate(imp.field(record, "date"))
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseCents(imp.field(record, "amount"))
+	if err != nil {
+		return nil, err
+	}
+	// expenses are negative in some versions of the export
+	if amount < 0 {
+		amount = -amount
+	}
+
+	transaction := &Transaction{
+		Amount:   uint32(amount),
+		Date:     date,
+		Category: imp.field(record, "category"),
+		Title:    imp.field(record, "title"),
+		Currency: imp.field(record, "currency"),
+	}
+	switch kind := strings.ToLower(imp.field(record, "transaction type")); kind {
+	case "", "normal", "expense":
+		if transaction.Category == "" {
+			transaction.Category = ImportCategory
+		}
+	case "money transfer", "transfer":
+		transaction.Kind = KindTransfer
+		transaction.Category = ""
+	default:
+		return nil, fmt.Errorf(`transactions of type "%s" can not be imported`, kind)
+	}
+	// the rate is the one the file was made with, not the current rate of the group. It converts to the default
+	// currency of the tricount, the rates of the group apply when it is another currency or it is not known.
+	inDefault := imp.field(record, tricountDefaultAmount)
+	if inDefault != "" && amount != 0 && imp.defaultCurrency != "" && imp.defaultCurrency == imp.currency {
+		converted, err := parseCents(inDefault)
+		if err != nil {
+			return nil, err
+		}
+		transaction.ExchangeRate = math.Abs(float64(converted)) / float64(amount)
+	}
+	if transaction.PaidBy, err = imp.user(imp.field(record, "paid by")); err != nil {
+		return nil, err
+	}
+
+	shares := map[string]int64{}
+	for i, name := range imp.members {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		share, err := parseCents(record[i])
+		if err != nil {
+			return nil, err
+		}
+		if share < 0 {
+			share = -share
+		}
+		if share != 0 {
+			shares[name] = share
+		}
+	}
+	if err := imp.addShares(transaction, shares, amount); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// addShares sets the members the transaction was paid for, forcing their share, which must add up to the amount
+func (imp *importer) addShares(transaction *Transaction, shares map[string]int64, amount int64) error {
+	total := int64(0)
+	for _, i := range sortedColumns(imp.members) {
+		name := imp.members[i]
+		share, ok := shares[name]
+		if !ok || share <= 0 {
+			continue
+		}
+		userId, err := imp.user(name)
+		if err != nil {
+			return err
+		}
+		target := &TransactionTarget{User: userId, ForcePrice: uint32(share)}
+		// the receiver of a transfer gets the whole amount, see ComputePrices
+		if transaction.GetKind() == KindTransfer {
+			target.ForcePrice = 0
+		}
+		transaction.PaidFor = append(transaction.PaidFor, target)
+		total += share
+	}
+	if total != amount {
+		return fmt.Errorf("the shares of the members add up to %d hundredths instead of %d", total, amount)
+	}
+	return nil
+}
+
+func sortedColumns(members map[int]string) []int {
+	columns := []int{}
+	for i := range members {
+		columns = append(columns, i)
+	}
+	sort.Ints(columns)
+	return columns
+}
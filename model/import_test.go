@@ -0,0 +1,161 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resolveNames maps the names of the test files to users, Dan is left out
+func resolveNames(name string) (primitive.ObjectID, bool) {
+	userId, ok := map[string]primitive.ObjectID{"Alice": ann, "Bob": bob, "Carol": carol}[name]
+	return userId, ok
+}
+
+// splitwiseExport is an "Export as spreadsheet" file of Splitwise, with the byte order mark it starts with
+const splitwiseExport = "\ufeffDate,Description,Category,Cost,Currency,Alice,Bob,Carol\n" +
+	"\n" +
+	"2024-01-05,Groceries,Groceries,60.00,EUR,40.00,-20.00,-20.00\n" +
+	"2024-01-06,Bob paid Alice,Payment,20.00,EUR,-20.00,20.00,0.00\n" +
+	"2024-01-07,Museum,Entertainment,30.00,EUR,10.00,10.00,-20.00\n" +
+	"2024-01-08,Hotel,,90.00,EUR,-30.00,-30.00,60.00\n" +
+	"\n" +
+	"2024-01-09,Total balance, , ,EUR,0.00,-20.00,20.00\n"
+
+func TestParseSplitwise(t *testing.T) {
+	report, err := ParseImport(ImportSplitwise, strings.NewReader(splitwiseExport), "EUR", resolveNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ImportLine{
+		{Line: 3, Transaction: &Transaction{
+			Amount: 6000, Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), Category: "Groceries", Title: "Groceries", Currency: "EUR", PaidBy: ann,
+			PaidFor: []*TransactionTarget{{User: ann, ForcePrice: 2000}, {User: bob, ForcePrice: 2000}, {User: carol, ForcePrice: 2000}},
+		}},
+		{Line: 4, Transaction: &Transaction{
+			Kind: KindTransfer, Amount: 2000, Date: time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), Title: "Bob paid Alice", Currency: "EUR", PaidBy: bob,
+			PaidFor: []*TransactionTarget{{User: ann}},
+		}},
+		{Line: 6, Transaction: &Transaction{
+			Amount: 9000, Date: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), Category: ImportCategory, Title: "Hotel", Currency: "EUR", PaidBy: carol,
+			PaidFor: []*TransactionTarget{{User: ann, ForcePrice: 3000}, {User: bob, ForcePrice: 3000}, {User: carol, ForcePrice: 3000}},
+		}},
+	}
+	if !reflect.DeepEqual(report.Accepted, want) {
+		t.Errorf("accepted lines:\n%s\nwant\n%s", lines(report.Accepted), lines(want))
+	}
+	// the line paid by several members is rejected, the total balance is not a transaction
+	if len(report.Rejected) != 1 || report.Rejected[0].Line != 5 || !strings.Contains(report.Rejected[0].Error, "several members") {
+		t.Errorf("rejected lines = %+v, want line 5 paid by several members", report.Rejected)
+	}
+	if len(report.UnknownNames) != 0 {
+		t.Errorf("unknown names = %v, want none", report.UnknownNames)
+	}
+}
+
+// tricountExport is the CSV export of a tricount in euros, made in a locale with decimal commas
+const tricountExport = "Title,Amount,Currency,Exchange rate,Amount in default currency (EUR),Date & time,Transaction type,Category,Paid by,Impacted to Alice,Impacted to Bob,Impacted to Dan\n" +
+	`Dinner,"-45,00",EUR,"1,00","-45,00",2024-01-05 20:15:00,Normal,Food & Drinks,Alice,"-22,50","-22,50",` + "\n" +
+	`Taxi,"-10,00",USD,"0,92","-9,20",2024-01-06 08:00:00,Normal,Transport,Bob,"-5,00","-5,00",` + "\n" +
+	`Refund,"22,50",EUR,"1,00","22,50",2024-01-07 10:00:00,Money transfer,,Bob,"22,50",,` + "\n" +
+	`Boat,"-30,00",EUR,"1,00","-30,00",2024-01-08 09:00:00,Normal,,Alice,"-10,00","-10,00","-10,00"` + "\n" +
+	`Snacks,"-12,00",EUR,"1,00","-12,00",2024-01-09 16:00:00,Normal,,Alice,"-5,00","-5,00",` + "\n"
+
+func TestParseTricount(t *testing.T) {
+	report, err := ParseImport(ImportTricount, strings.NewReader(tricountExport), "EUR", resolveNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ImportLine{
+		{Line: 2, Transaction: &Transaction{
+			Amount: 4500, Date: time.Date(2024, 1, 5, 20, 15, 0, 0, time.UTC), Category: "Food & Drinks", Title: "Dinner", Currency: "EUR", ExchangeRate: 1, PaidBy: ann,
+			PaidFor: []*TransactionTarget{{User: ann, ForcePrice: 2250}, {User: bob, ForcePrice: 2250}},
+		}},
+		{Line: 3, Transaction: &Transaction{
+			Amount: 1000, Date: time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC), Category: "Transport", Title: "Taxi", Currency: "USD", ExchangeRate: 0.92, PaidBy: bob,
+			PaidFor: []*TransactionTarget{{User: ann, ForcePrice: 500}, {User: bob, ForcePrice: 500}},
+		}},
+		{Line: 4, Transaction: &Transaction{
+			Kind: KindTransfer, Amount: 2250, Date: time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC), Title: "Refund", Currency: "EUR", ExchangeRate: 1, PaidBy: bob,
+			PaidFor: []*TransactionTarget{{User: ann}},
+		}},
+	}
+	if !reflect.DeepEqual(report.Accepted, want) {
+		t.Errorf("accepted lines:\n%s\nwant\n%s", lines(report.Accepted), lines(want))
+	}
+	if len(report.Rejected) != 2 ||
+		report.Rejected[0].Line != 5 || !strings.Contains(report.Rejected[0].Error, `"Dan" is not mapped`) ||
+		report.Rejected[1].Line != 6 || !strings.Contains(report.Rejected[1].Error, "add up to 1000 hundredths instead of 1200") {
+		t.Errorf("rejected lines = %+v, want the line shared with Dan and the line whose shares do not add up", report.Rejected)
+	}
+	if !reflect.DeepEqual(report.UnknownNames, []string{"Dan"}) {
+		t.Errorf("unknown names = %v, want Dan", report.UnknownNames)
+	}
+}
+
+func TestParseTricountOtherCurrency(t *testing.T) {
+	// the rates of the file convert to euros, the rates of a group in francs must apply instead
+	report, err := ParseImport(ImportTricount, strings.NewReader(tricountExport), "CHF", resolveNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range report.Accepted {
+		if line.Transaction.ExchangeRate != 0 {
+			t.Errorf("line %d: exchange rate = %v, want none", line.Line, line.Transaction.ExchangeRate)
+		}
+	}
+
+	// without the currency in the header, the default currency of the tricount is not known
+	header := strings.Replace(tricountExport, "Amount in default currency (EUR)", "Amount in default currency", 1)
+	report, err = ParseImport(ImportTricount, strings.NewReader(header), "EUR", resolveNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range report.Accepted {
+		if line.Transaction.ExchangeRate != 0 {
+			t.Errorf("line %d: exchange rate = %v, want none", line.Line, line.Transaction.ExchangeRate)
+		}
+	}
+}
+
+func TestParseImportHeader(t *testing.T) {
+	tests := []struct {
+		format ImportFormat
+		data   string
+		err    string
+	}{
+		{ImportSplitwise, "", "the file is empty"},
+		{ImportSplitwise, "Date,Description,Cost,Currency,Alice\n", `"category" column`},
+		{ImportTricount, "Title,Amount,Date,Paid by\n", `"Impacted to" column`},
+		{ImportTricount, "Title,Amount,Paid by,Impacted to Alice\n", `"date" column`},
+		{"other", "Title\n", `field "format"`},
+	}
+	for _, test := range tests {
+		_, err := ParseImport(test.format, strings.NewReader(test.data), "EUR", resolveNames)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %q: error = %v, want one about %s", test.format, test.data, err, test.err)
+		}
+	}
+}
+
+// lines formats the lines of a report for the errors of the tests
+func lines(lines []ImportLine) string {
+	out := []string{}
+	for _, line := range lines {
+		text := fmt.Sprintf("%d: %s", line.Line, line.Error)
+		if line.Transaction != nil {
+			text = fmt.Sprintf("%d: %+v", line.Line, *line.Transaction)
+			for _, target := range line.Transaction.PaidFor {
+				text += fmt.Sprintf(" %+v", *target)
+			}
+		}
+		out = append(out, text)
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitation lets anyone knowing its token join a group. Only a hash of the token is stored,
+// the token itself is only sent when the invitation is created.
+type Invitation struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Group     primitive.ObjectID `json:"group" bson:"group"`
+	Token     string             `json:"token,omitempty" bson:"-"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// ExpiresAt is the time after which the invitation can not be used, it never expires when zero
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	// MaxUses is how many users can join with the invitation, unlimited when zero
+	MaxUses   uint32     `json:"maxUses,omitempty" bson:"maxUses,omitempty"`
+	Uses      uint32     `json:"uses" bson:"uses"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// Usable reports whether someone can join the group with the invitation at the given time
+func (i *Invitation) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "daily"
+	FrequencyWeekly  Frequency = "weekly"
+	FrequencyMonthly Frequency = "monthly"
+	FrequencyYearly  Frequency = "yearly"
+)
+
+// Recurrence is the subset of an iCalendar RRULE made of FREQ, INTERVAL, DTSTART and UNTIL
+type Recurrence struct {
+	Frequency Frequency `json:"frequency" bson:"frequency"`
+	// Interval is the number of periods between two occurrences, 1 when zero
+	Interval uint32    `json:"interval,omitempty" bson:"interval,omitempty"`
+	Start    time.Time `json:"start" bson:"start"`
+	// End is optional, there is no occurrence after it
+	End *time.Time `json:"end,omitempty" bson:"end,omitempty"`
+}
+
+func (r *Recurrence) Validate() error {
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+	default:
+		return fmt.Errorf(`field "recurrence.frequency" must be one of "%s", "%s", "%s" or "%s"`, FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly)
+	}
+	if r.Start.IsZero() {
+		return fmt.Errorf(`field "recurrence.start" must be filled`)
+	}
+	if r.End != nil && r.End.Before(r.Start) {
+		return fmt.Errorf(`field "recurrence.end" must not be before "recurrence.start"`)
+	}
+	return nil
+}
+
+// Occurrence returns the date of the occurrence n of the recurrence, the first one being n = 0.
+// Monthly and yearly occurrences falling after the end of a month happen on its last day, like rent paid on the 31st.
+func (r *Recurrence) Occurrence(n int) time.Time {
+	interval := int(r.Interval)
+	if interval == 0 {
+		interval = 1
+	}
+	switch r.Frequency {
+	case FrequencyWeekly:
+		return r.Start.AddDate(0, 0, 7*n*interval)
+	case FrequencyMonthly:
+		return addMonths(r.Start, n*interval)
+	case FrequencyYearly:
+		return addMonths(r.Start, 12*n*interval)
+	default:
+		return r.Start.AddDate(0, 0, n*interval)
+	}
+}
+
+// firstFrom returns the index of the first occurrence at or after the given date.
+// It is estimated from the time elapsed since the start, then adjusted to what Occurrence returns.
+func (r *Recurrence) firstFrom(date time.Time) int {
+	if !date.After(r.Start) {
+		return 0
+	}
+	interval := int(r.Interval)
+	if interval == 0 {
+		interval = 1
+	}
+	var n int
+	switch r.Frequency {
+	case FrequencyWeekly, FrequencyDaily:
+		days := interval
+		if r.Frequency == FrequencyWeekly {
+			days *= 7
+		}
+		n = int(date.Sub(r.Start).Hours() / 24 / float64(days))
+	default:
+		months := interval
+		if r.Frequency == FrequencyYearly {
+			months *= 12
+		}
+		n = ((date.Year()-r.Start.Year())*12 + int(date.Month()-r.Start.Month())) / months
+	}
+	for n > 0 && !r.Occurrence(n-1).Before(date) {
+		n--
+	}
+	for r.Occurrence(n).Before(date) {
+		n++
+	}
+	return n
+}
+
+// addMonths adds months to date, keeping the day of month when the resulting month has it
+func addMonths(date time.Time, months int) time.Time {
+	year, month, day := date.Date()
+	first := time.Date(year, month+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// RecurringTransaction creates a copy of its template on each occurrence of its recurrence
+type RecurringTransaction struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Group      primitive.ObjectID `json:"group" bson:"group"`
+	Recurrence Recurrence         `json:"recurrence" bson:"recurrence"`
+	// Template is the transaction created on each occurrence, its date is the one of the occurrence
+	Template  Transaction        `json:"template" bson:"template"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// Skipped are the dates of the occurrences that must not create a transaction
+	Skipped []time.Time `json:"skipped" bson:"skipped"`
+	// Last is the date of the last occurrence that created a transaction
+	Last *time.Time `json:"last,omitempty" bson:"last,omitempty"`
+	// NextDate is the date of the next occurrence to create, there is none left when it is empty
+	NextDate *time.Time `json:"nextDate,omitempty" bson:"nextDate,omitempty"`
+	// Version is incremented by every change, it is sent as the ETag of the recurring transaction
+	Version uint32 `json:"version" bson:"version"`
+}
+
+func (r *RecurringTransaction) Validate() error {
+	if err := r.Recurrence.Validate(); err != nil {
+		return err
+	}
+	// the template is validated as the transaction of the first occurrence
+	template := r.Occurrence(r.Recurrence.Start)
+	if err := template.Validate(); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	return nil
+}
+
+// IsSkipped reports whether the occurrence of the given date must not create a transaction
+func (r *RecurringTransaction) IsSkipped(date time.Time) bool {
+	for _, skipped := range r.Skipped {
+		if skipped.Equal(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOccurrence reports whether a transaction is created on the given date, skipped or not
+func (r *RecurringTransaction) IsOccurrence(date time.Time) bool {
+	if r.Recurrence.End != nil && date.After(*r.Recurrence.End) {
+		return false
+	}
+	return r.Recurrence.Occurrence(r.Recurrence.firstFrom(date)).Equal(date)
+}
+
+// Schedule sets NextDate to the first occurrence after Last that is not skipped
+func (r *RecurringTransaction) Schedule() {
+	r.NextDate = nil
+	n := 0
+	if r.Last != nil {
+		n = r.Recurrence.firstFrom(*r.Last)
+	}
+	for ; ; n++ {
+		date := r.Recurrence.Occurrence(n)
+		if r.Recurrence.End != nil && date.After(*r.Recurrence.End) {
+			return
+		}
+		if (r.Last == nil || date.After(*r.Last)) && !r.IsSkipped(date) {
+			r.NextDate = &date
+			return
+		}
+	}
+}
+
+// Occurrence returns the transaction created by the occurrence of the given date
+func (r *RecurringTransaction) Occurrence(date time.Time) Transaction {
+	transaction := r.Template
+	// prices are computed on the targets, they must not be shared with the template
+	transaction.PaidFor = make([]*TransactionTarget, len(r.Template.PaidFor))
+	for i, target := range r.Template.PaidFor {
+		copied := *target
+		transaction.PaidFor[i] = &copied
+	}
+	transaction.Id = primitive.NilObjectID
+	transaction.Group = r.Group
+	transaction.Date = date
+	transaction.DeletedAt = nil
+	transaction.Version = 0
+	recurring := r.Id
+	transaction.Recurring = &recurring
+	return transaction
+}
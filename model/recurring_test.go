@@ -0,0 +1,122 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 12, 0, 0, 0, time.UTC)
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		date   time.Time
+		months int
+		want   time.Time
+	}{
+		{day(2023, time.January, 31), 1, day(2023, time.February, 28)},
+		{day(2024, time.January, 31), 1, day(2024, time.February, 29)},
+		{day(2024, time.January, 31), 2, day(2024, time.March, 31)},
+		{day(2024, time.March, 31), 1, day(2024, time.April, 30)},
+		{day(2024, time.January, 30), 1, day(2024, time.February, 29)},
+		{day(2024, time.January, 15), 1, day(2024, time.February, 15)},
+		{day(2024, time.December, 31), 2, day(2025, time.February, 28)},
+		{day(2024, time.February, 29), 12, day(2025, time.February, 28)},
+		{day(2024, time.February, 29), 48, day(2028, time.February, 29)},
+	}
+	for _, test := range tests {
+		if got := addMonths(test.date, test.months); !got.Equal(test.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", test.date.Format("2006-01-02"), test.months, got.Format("2006-01-02"), test.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestRecurrenceFirstFrom(t *testing.T) {
+	recurrences := []Recurrence{
+		{Frequency: FrequencyDaily, Start: day(2024, time.January, 31)},
+		{Frequency: FrequencyDaily, Interval: 3, Start: day(2024, time.January, 31)},
+		{Frequency: FrequencyWeekly, Interval: 2, Start: day(2024, time.January, 31)},
+		{Frequency: FrequencyMonthly, Start: day(2024, time.January, 31)},
+		{Frequency: FrequencyMonthly, Interval: 5, Start: day(2024, time.January, 31)},
+		{Frequency: FrequencyYearly, Start: day(2024, time.February, 29)},
+	}
+	// days are 23 or 25 hours long when daylight saving time changes
+	if paris, err := time.LoadLocation("Europe/Paris"); err == nil {
+		recurrences = append(recurrences, Recurrence{Frequency: FrequencyDaily, Start: time.Date(2024, time.March, 1, 0, 30, 0, 0, paris)})
+	}
+	for _, recurrence := range recurrences {
+		// the first occurrence at or after each date, found by going through all of them
+		n := 0
+		for date := recurrence.Start.AddDate(0, 0, -3); date.Before(recurrence.Start.AddDate(3, 0, 0)); date = date.Add(7 * time.Hour) {
+			for recurrence.Occurrence(n).Before(date) {
+				n++
+			}
+			if got := recurrence.firstFrom(date); got != n {
+				t.Fatalf("%s every %d from %s: firstFrom(%s) = %d, want %d", recurrence.Frequency, recurrence.Interval, recurrence.Start, date, got, n)
+			}
+		}
+	}
+}
+
+func TestIsOccurrence(t *testing.T) {
+	end := day(2025, time.January, 31)
+	recurring := RecurringTransaction{Recurrence: Recurrence{Frequency: FrequencyMonthly, Start: day(2024, time.January, 31), End: &end}}
+	tests := []struct {
+		date time.Time
+		want bool
+	}{
+		{day(2024, time.January, 31), true},
+		{day(2024, time.February, 29), true},
+		{day(2024, time.February, 28), false},
+		{day(2024, time.April, 30), true},
+		{day(2023, time.December, 31), false},
+		{day(2025, time.January, 31), true},
+		{day(2025, time.February, 28), false},
+		{day(2024, time.May, 31).Add(time.Minute), false},
+	}
+	for _, test := range tests {
+		if got := recurring.IsOccurrence(test.date); got != test.want {
+			t.Errorf("IsOccurrence(%s) = %v, want %v", test.date, got, test.want)
+		}
+	}
+
+	// a date far away is found without going through every occurrence
+	daily := RecurringTransaction{Recurrence: Recurrence{Frequency: FrequencyDaily, Start: day(2024, time.January, 1)}}
+	if !daily.IsOccurrence(day(9999, time.December, 31)) {
+		t.Errorf("IsOccurrence(9999-12-31) = false, want true")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	end := day(2024, time.May, 31)
+	tests := []struct {
+		name    string
+		last    *time.Time
+		skipped []time.Time
+		want    *time.Time
+	}{
+		{"the first occurrence", nil, nil, ptr(day(2024, time.January, 31))},
+		{"a skipped first occurrence", nil, []time.Time{day(2024, time.January, 31)}, ptr(day(2024, time.February, 29))},
+		{"after the last one", ptr(day(2024, time.February, 29)), nil, ptr(day(2024, time.March, 31))},
+		{"several skipped occurrences", ptr(day(2024, time.February, 29)), []time.Time{day(2024, time.April, 30), day(2024, time.March, 31)}, ptr(day(2024, time.May, 31))},
+		{"skipped occurrences before the last one", ptr(day(2024, time.March, 31)), []time.Time{day(2024, time.February, 29)}, ptr(day(2024, time.April, 30))},
+		{"every occurrence left is skipped", ptr(day(2024, time.March, 31)), []time.Time{day(2024, time.April, 30), day(2024, time.May, 31)}, nil},
+		{"the last occurrence was created", ptr(end), nil, nil},
+	}
+	for _, test := range tests {
+		recurring := RecurringTransaction{
+			Recurrence: Recurrence{Frequency: FrequencyMonthly, Start: day(2024, time.January, 31), End: &end},
+			Last:       test.last,
+			Skipped:    test.skipped,
+		}
+		recurring.Schedule()
+		if (recurring.NextDate == nil) != (test.want == nil) || (test.want != nil && !recurring.NextDate.Equal(*test.want)) {
+			t.Errorf("%s: next date = %v, want %v", test.name, recurring.NextDate, test.want)
+		}
+	}
+}
+
+func ptr(date time.Time) *time.Time {
+	return &date
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is an opaque token given to a user when logging in. Only a hash of the token is stored.
+type Session struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+}
+
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Settlement is a transfer of money that must happen between two users to settle a group
+type Settlement struct {
+	From   primitive.ObjectID `json:"from"`
+	To     primitive.ObjectID `json:"to"`
+	Amount uint32             `json:"amount"`
+}
+
+type settleEntry struct {
+	user   primitive.ObjectID
+	amount int64
+}
+
+// sortSettleEntries orders entries by decreasing amount, then by user id so the result is deterministic
+func sortSettleEntries(entries []settleEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].amount != entries[j].amount {
+			return entries[i].amount > entries[j].amount
+		}
+		return entries[i].user.Hex() < entries[j].user.Hex()
+	})
+}
+
+// Settle computes a list of transfers zeroing the given balances.
+//
+// Debtors and creditors are both sorted by decreasing amount and matched greedily,
+// which gives at most n-1 transfers for n users and always the same output for the same balances.
+// Prices add up to the amount of their transaction, but their conversion into the group currency is rounded,
+// so the debts of a group can differ from its credits by a few units: those leftovers are not settled.
+func Settle(balances map[primitive.ObjectID]*Balance) []Settlement {
+	creditors := []settleEntry{}
+	debtors := []settleEntry{}
+	for user, balance := range balances {
+		if balance.TotalAmount > 0 {
+			creditors = append(creditors, settleEntry{user: user, amount: int64(balance.TotalAmount)})
+		} else if balance.TotalAmount < 0 {
+			debtors = append(debtors, settleEntry{user: user, amount: -int64(balance.TotalAmount)})
+		}
+	}
+	sortSettleEntries(creditors)
+	sortSettleEntries(debtors)
+
+	settlements := []Settlement{}
+	i, j := 0, 0
+	for i < len(debtors) && j < len(creditors) {
+		amount := debtors[i].amount
+		if creditors[j].amount < amount {
+			amount = creditors[j].amount
+		}
+		settlements = append(settlements, Settlement{
+			From:   debtors[i].user,
+			To:     creditors[j].user,
+			Amount: uint32(amount),
+		})
+
+		debtors[i].amount -= amount
+		creditors[j].amount -= amount
+		if debtors[i].amount == 0 {
+			i++
+		}
+		if creditors[j].amount == 0 {
+			j++
+		}
+	}
+
+	return settlements
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ann   = primitive.ObjectID{1}
+	bob   = primitive.ObjectID{2}
+	carol = primitive.ObjectID{3}
+	dan   = primitive.ObjectID{4}
+)
+
+func expense(paidBy primitive.ObjectID, amount uint32, paidFor ...*TransactionTarget) Transaction {
+	return Transaction{
+		Group:    primitive.ObjectID{9},
+		PaidBy:   paidBy,
+		PaidFor:  paidFor,
+		Amount:   amount,
+		Date:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Category: "food",
+	}
+}
+
+func transfer(from primitive.ObjectID, to primitive.ObjectID, amount uint32) Transaction {
+	transaction := expense(from, amount, &TransactionTarget{User: to})
+	transaction.Kind = KindTransfer
+	return transaction
+}
+
+func TestSettle(t *testing.T) {
+	tests := []struct {
+		name         string
+		transactions []Transaction
+		// prices are the computed prices of the first transaction
+		prices    []uint32
+		transfers []Settlement
+	}{
+		{
+			name: "100 split three ways gives the leftover unit to the first member",
+			transactions: []Transaction{
+				expense(ann, 100, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}, &TransactionTarget{User: carol, Weight: 1}),
+			},
+			prices: []uint32{34, 33, 33},
+			transfers: []Settlement{
+				{From: bob, To: ann, Amount: 33},
+				{From: carol, To: ann, Amount: 33},
+			},
+		},
+		{
+			name: "200 split three ways gives the two leftover units to the first members",
+			transactions: []Transaction{
+				expense(bob, 200, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}, &TransactionTarget{User: carol, Weight: 1}),
+			},
+			prices: []uint32{67, 67, 66},
+			transfers: []Settlement{
+				{From: ann, To: bob, Amount: 67},
+				{From: carol, To: bob, Amount: 66},
+			},
+		},
+		{
+			name: "force prices leaving nothing to split",
+			transactions: []Transaction{
+				expense(ann, 100, &TransactionTarget{User: bob, ForcePrice: 60}, &TransactionTarget{User: carol, ForcePrice: 40}, &TransactionTarget{User: dan, Weight: 1}),
+			},
+			prices: []uint32{60, 40, 0},
+			transfers: []Settlement{
+				{From: bob, To: ann, Amount: 60},
+				{From: carol, To: ann, Amount: 40},
+			},
+		},
+		{
+			name: "force prices with a rest split by weight",
+			transactions: []Transaction{
+				expense(ann, 101, &TransactionTarget{User: bob, ForcePrice: 50}, &TransactionTarget{User: carol, Weight: 1}, &TransactionTarget{User: dan, Weight: 2}),
+			},
+			prices: []uint32{50, 17, 34},
+			transfers: []Settlement{
+				{From: bob, To: ann, Amount: 50},
+				{From: dan, To: ann, Amount: 34},
+				{From: carol, To: ann, Amount: 17},
+			},
+		},
+		{
+			name: "transfers settle expenses",
+			transactions: []Transaction{
+				transfer(bob, ann, 30),
+				expense(ann, 90, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}, &TransactionTarget{User: carol, Weight: 1}),
+			},
+			prices: []uint32{30},
+			transfers: []Settlement{
+				{From: carol, To: ann, Amount: 30},
+			},
+		},
+		{
+			name: "several payers",
+			transactions: []Transaction{
+				expense(ann, 100, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}, &TransactionTarget{User: carol, Weight: 1}, &TransactionTarget{User: dan, Weight: 1}),
+				expense(bob, 50, &TransactionTarget{User: carol, Weight: 1}, &TransactionTarget{User: dan, Weight: 1}),
+				transfer(dan, carol, 7),
+			},
+			prices: []uint32{25, 25, 25, 25},
+			transfers: []Settlement{
+				{From: carol, To: ann, Amount: 57},
+				{From: dan, To: ann, Amount: 18},
+				{From: dan, To: bob, Amount: 25},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			balances, err := ComputeBalances([]primitive.ObjectID{ann, bob, carol, dan}, test.transactions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prices := []uint32{}
+			for _, target := range test.transactions[0].PaidFor {
+				prices = append(prices, target.ComputedPrice)
+			}
+			if !reflect.DeepEqual(prices, test.prices) {
+				t.Errorf("prices = %v, want %v", prices, test.prices)
+			}
+
+			transfers := Settle(balances)
+			if !reflect.DeepEqual(transfers, test.transfers) {
+				t.Errorf("transfers = %v, want %v", transfers, test.transfers)
+			}
+			// balances are read from a map, the order of its iteration must not matter
+			for i := 0; i < 10; i++ {
+				if again := Settle(balances); !reflect.DeepEqual(again, transfers) {
+					t.Fatalf("transfers changed from %v to %v", transfers, again)
+				}
+			}
+
+			for _, transfer := range transfers {
+				balances[transfer.From].TotalAmount += int32(transfer.Amount)
+				balances[transfer.To].TotalAmount -= int32(transfer.Amount)
+			}
+			for user, balance := range balances {
+				if balance.TotalAmount != 0 {
+					t.Errorf("balance of %s is %d after the transfers", user.Hex(), balance.TotalAmount)
+				}
+			}
+		})
+	}
+}
+
+func TestComputePrices(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction Transaction
+		prices      []uint32
+		fails       bool
+	}{
+		{
+			name:        "force prices leaving a rest no one has a weight to pay",
+			transaction: expense(ann, 100, &TransactionTarget{User: bob, ForcePrice: 60}, &TransactionTarget{User: carol, ForcePrice: 30}),
+			fails:       true,
+		},
+		{
+			name:        "force prices higher than the amount",
+			transaction: expense(ann, 100, &TransactionTarget{User: bob, ForcePrice: 60}, &TransactionTarget{User: carol, ForcePrice: 50}),
+			fails:       true,
+		},
+		{
+			name:        "large amounts and weights",
+			transaction: expense(ann, 4_000_000_000, &TransactionTarget{User: bob, Weight: 3_000_000}, &TransactionTarget{User: carol, Weight: 1_000_000}),
+			prices:      []uint32{3_000_000_000, 1_000_000_000},
+		},
+		{
+			name:        "weights adding up beyond 32 bits",
+			transaction: expense(ann, 10, &TransactionTarget{User: bob, Weight: 4_000_000_000}, &TransactionTarget{User: carol, Weight: 4_000_000_000}),
+			prices:      []uint32{5, 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.transaction.ComputePrices()
+			if (err != nil) != test.fails {
+				t.Fatalf("error = %v, want an error: %v", err, test.fails)
+			}
+			if test.fails {
+				return
+			}
+			prices := []uint32{}
+			for _, target := range test.transaction.PaidFor {
+				prices = append(prices, target.ComputedPrice)
+			}
+			if !reflect.DeepEqual(prices, test.prices) {
+				t.Errorf("prices = %v, want %v", prices, test.prices)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StatsTotal sums the amounts of some expenses, in the group currency
+type StatsTotal struct {
+	Total int64 `json:"total" bson:"total"`
+	Count int64 `json:"count" bson:"count"`
+}
+
+func (t *StatsTotal) add(amount uint32) {
+	t.Total += int64(amount)
+	t.Count++
+}
+
+type CategoryStats struct {
+	Category   string `json:"category" bson:"_id"`
+	StatsTotal `bson:",inline"`
+}
+
+// UserStats sums the amounts paid by a user, or the shares of a user in the expenses
+type UserStats struct {
+	User       primitive.ObjectID `json:"user" bson:"_id"`
+	StatsTotal `bson:",inline"`
+}
+
+// PeriodStats sums the expenses of a day, like "2024-01-31", or of an ISO week, like "2024-W05"
+type PeriodStats struct {
+	Period     string `json:"period" bson:"_id"`
+	StatsTotal `bson:",inline"`
+}
+
+// GroupStats describes the expenses of a group, transfers are not expenses.
+// Totals are sorted from the biggest to the smallest, periods chronologically.
+type GroupStats struct {
+	StatsTotal    `bson:",inline"`
+	ByCategory    []CategoryStats `json:"byCategory" bson:"byCategory"`
+	ByPayer       []UserStats     `json:"byPayer" bson:"byPayer"`
+	ByParticipant []UserStats     `json:"byParticipant" bson:"byParticipant"`
+	ByDay         []PeriodStats   `json:"byDay" bson:"byDay"`
+	ByWeek        []PeriodStats   `json:"byWeek" bson:"byWeek"`
+	// AveragePerPerson is the total divided by the number of members of the group
+	AveragePerPerson int64 `json:"averagePerPerson" bson:"-"`
+	// Biggest are the biggest expenses, in the group currency
+	Biggest []Transaction `json:"biggest" bson:"biggest"`
+}
+
+// Day returns the day of a date in the stats, in UTC
+func Day(date time.Time) string {
+	return date.UTC().Format("2006-01-02")
+}
+
+// Week returns the ISO week of a date in the stats, in UTC
+func Week(date time.Time) string {
+	year, week := date.UTC().ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
+
+// ComputeGroupStats returns the stats of the given transactions of a group, keeping the given number of biggest expenses.
+// The shares of the participants are the computed prices stored with the transactions, they are not computed again.
+func ComputeGroupStats(transactions []Transaction, biggest int) GroupStats {
+	stats := GroupStats{ByCategory: []CategoryStats{}}
+	categories := map[string]*StatsTotal{}
+	payers := map[primitive.ObjectID]*StatsTotal{}
+	participants := map[primitive.ObjectID]*StatsTotal{}
+	days := map[string]*StatsTotal{}
+	weeks := map[string]*StatsTotal{}
+	keyTotal := func(totals map[string]*StatsTotal, key string) *StatsTotal {
+		if _, ok := totals[key]; !ok {
+			totals[key] = &StatsTotal{}
+		}
+		return totals[key]
+	}
+	userTotal := func(totals map[primitive.ObjectID]*StatsTotal, userId primitive.ObjectID) *StatsTotal {
+		if _, ok := totals[userId]; !ok {
+			totals[userId] = &StatsTotal{}
+		}
+		return totals[userId]
+	}
+
+	expenses := []Transaction{}
+	for _, transaction := range transactions {
+		if transaction.GetKind() != KindExpense {
+			continue
+		}
+		expenses = append(expenses, transaction)
+
+		amount := transaction.InGroupCurrency(transaction.Amount)
+		stats.add(amount)
+		keyTotal(categories, transaction.Category).add(amount)
+		userTotal(payers, transaction.PaidBy).add(amount)
+		keyTotal(days, Day(transaction.Date)).add(amount)
+		keyTotal(weeks, Week(transaction.Date)).add(amount)
+		for _, target := range transaction.PaidFor {
+			userTotal(participants, target.User).add(transaction.InGroupCurrency(target.ComputedPrice))
+		}
+	}
+
+	for category, total := range categories {
+		stats.ByCategory = append(stats.ByCategory, CategoryStats{Category: category, StatsTotal: *total})
+	}
+	sort.Slice(stats.ByCategory, func(i, j int) bool {
+		a, b := stats.ByCategory[i], stats.ByCategory[j]
+		return a.Total > b.Total || (a.Total == b.Total && a.Category < b.Category)
+	})
+	stats.ByPayer = sortedUserStats(payers)
+	stats.ByParticipant = sortedUserStats(participants)
+	stats.ByDay = sortedPeriodStats(days)
+	stats.ByWeek = sortedPeriodStats(weeks)
+
+	// newest first among equal amounts
+	sort.SliceStable(expenses, func(i, j int) bool {
+		a, b := expenses[i].InGroupCurrency(expenses[i].Amount), expenses[j].InGroupCurrency(expenses[j].Amount)
+		return a > b || (a == b && expenses[i].Id.Hex() > expenses[j].Id.Hex())
+	})
+	if len(expenses) > biggest {
+		expenses = expenses[:biggest]
+	}
+	stats.Biggest = expenses
+
+	return stats
+}
+
+func sortedUserStats(totals map[primitive.ObjectID]*StatsTotal) []UserStats {
+	stats := []UserStats{}
+	for userId, total := range totals {
+		stats = append(stats, UserStats{User: userId, StatsTotal: *total})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		return a.Total > b.Total || (a.Total == b.Total && a.User.Hex() < b.User.Hex())
+	})
+	return stats
+}
+
+func sortedPeriodStats(totals map[string]*StatsTotal) []PeriodStats {
+	stats := []PeriodStats{}
+	for period, total := range totals {
+		stats = append(stats, PeriodStats{Period: period, StatsTotal: *total})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Period < stats[j].Period
+	})
+	return stats
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestComputeGroupStatsStoredPrices(t *testing.T) {
+	// prices saved by an older version of ComputePrices, which rounded every share up
+	transaction := expense(ann, 100, &TransactionTarget{User: ann, Weight: 1, ComputedPrice: 34}, &TransactionTarget{User: bob, Weight: 1, ComputedPrice: 34}, &TransactionTarget{User: carol, Weight: 1, ComputedPrice: 34})
+
+	stats := ComputeGroupStats([]Transaction{transaction}, 1)
+	if stats.Total != 100 {
+		t.Errorf("total = %d, want 100", stats.Total)
+	}
+	for _, participant := range stats.ByParticipant {
+		if participant.Total != 34 {
+			t.Errorf("share of %s = %d, want the stored 34", participant.User.Hex(), participant.Total)
+		}
+	}
+}
+
+// statsTransactions are expenses of ann, bob and carol over two weeks, with a transfer and an expense in another currency
+func statsTransactions() []Transaction {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	dinner := expense(ann, 300, &TransactionTarget{User: ann, ComputedPrice: 100}, &TransactionTarget{User: bob, ComputedPrice: 100}, &TransactionTarget{User: carol, ComputedPrice: 100})
+	dinner.Id = primitive.ObjectID{11}
+	hotel := expense(bob, 200, &TransactionTarget{User: ann, ComputedPrice: 100}, &TransactionTarget{User: bob, ComputedPrice: 100})
+	hotel.Id, hotel.Category, hotel.Date = primitive.ObjectID{12}, "lodging", day(2)
+	snack := expense(carol, 50, &TransactionTarget{User: carol, ComputedPrice: 50})
+	snack.Id, snack.Date = primitive.ObjectID{13}, day(8)
+	// 100 USD at 2 is 200 in the group currency
+	market := expense(ann, 100, &TransactionTarget{User: bob, ComputedPrice: 100})
+	market.Id, market.Date, market.Currency, market.ExchangeRate = primitive.ObjectID{14}, day(8), "USD", 2
+	refund := transfer(ann, bob, 1000)
+	refund.Id, refund.Date = primitive.ObjectID{15}, day(8)
+	refund.PaidFor[0].ComputedPrice = 1000
+	return []Transaction{dinner, hotel, snack, market, refund}
+}
+
+func TestComputeGroupStats(t *testing.T) {
+	stats := ComputeGroupStats(statsTransactions(), 2)
+
+	if stats.StatsTotal != (StatsTotal{Total: 750, Count: 4}) {
+		t.Errorf("total = %+v, want 750 over 4 expenses", stats.StatsTotal)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"by category", stats.ByCategory, []CategoryStats{
+			{Category: "food", StatsTotal: StatsTotal{Total: 550, Count: 3}},
+			{Category: "lodging", StatsTotal: StatsTotal{Total: 200, Count: 1}},
+		}},
+		{"by payer", stats.ByPayer, []UserStats{
+			{User: ann, StatsTotal: StatsTotal{Total: 500, Count: 2}},
+			{User: bob, StatsTotal: StatsTotal{Total: 200, Count: 1}},
+			{User: carol, StatsTotal: StatsTotal{Total: 50, Count: 1}},
+		}},
+		{"by participant", stats.ByParticipant, []UserStats{
+			{User: bob, StatsTotal: StatsTotal{Total: 400, Count: 3}},
+			{User: ann, StatsTotal: StatsTotal{Total: 200, Count: 2}},
+			{User: carol, StatsTotal: StatsTotal{Total: 150, Count: 2}},
+		}},
+		{"by day", stats.ByDay, []PeriodStats{
+			{Period: "2024-01-01", StatsTotal: StatsTotal{Total: 300, Count: 1}},
+			{Period: "2024-01-02", StatsTotal: StatsTotal{Total: 200, Count: 1}},
+			{Period: "2024-01-08", StatsTotal: StatsTotal{Total: 250, Count: 2}},
+		}},
+		{"by week", stats.ByWeek, []PeriodStats{
+			{Period: "2024-W01", StatsTotal: StatsTotal{Total: 500, Count: 2}},
+			{Period: "2024-W02", StatsTotal: StatsTotal{Total: 250, Count: 2}},
+		}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s = %+v, want %+v", test.name, test.got, test.want)
+		}
+	}
+
+	// the hotel and the market both cost 200, the newest comes first
+	var biggest []primitive.ObjectID
+	for _, transaction := range stats.Biggest {
+		biggest = append(biggest, transaction.Id)
+	}
+	if want := []primitive.ObjectID{{11}, {14}}; !reflect.DeepEqual(biggest, want) {
+		t.Errorf("biggest = %v, want %v", biggest, want)
+	}
+}
+
+func TestComputeGroupStatsTransfers(t *testing.T) {
+	stats := ComputeGroupStats([]Transaction{transfer(ann, bob, 1000)}, 5)
+	if stats.Total != 0 || stats.Count != 0 {
+		t.Errorf("total = %+v, want no expense", stats.StatsTotal)
+	}
+	if len(stats.ByCategory) != 0 || len(stats.ByPayer) != 0 || len(stats.ByParticipant) != 0 || len(stats.ByDay) != 0 || len(stats.ByWeek) != 0 || len(stats.Biggest) != 0 {
+		t.Errorf("stats of a transfer = %+v, want none", stats)
+	}
+}
+
+func TestWeek(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{time.Date(2024, 1, 7, 23, 0, 0, 0, time.UTC), "2024-W01"},
+		{time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), "2024-W02"},
+		// ISO weeks belong to the year of their thursday
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "2020-W53"},
+		{time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC), "2025-W01"},
+		// dates are read in UTC
+		{time.Date(2024, 1, 8, 0, 30, 0, 0, time.FixedZone("CET", 3600)), "2024-W01"},
+	}
+	for _, test := range tests {
+		if got := Week(test.date); got != test.want {
+			t.Errorf("Week(%s) = %s, want %s", test.date, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GroupSummary is the position of a user in one of their groups
+type GroupSummary struct {
+	Group    primitive.ObjectID `json:"group"`
+	Name     string             `json:"name"`
+	Currency string             `json:"currency,omitempty"`
+	Balance  Balance            `json:"balance"`
+}
+
+// SummaryTotals sums the positions of a user in the groups sharing a currency
+type SummaryTotals struct {
+	Currency string `json:"currency,omitempty"`
+	// Spent is what the user paid for expenses, transfers between members are not spending
+	Spent int64 `json:"spent"`
+	// Owed is what the user owes to the other members, the sum of the negative balances
+	Owed int64 `json:"owed"`
+	// Lent is what the other members owe to the user, the sum of the positive balances
+	Lent int64 `json:"lent"`
+}
+
+// UserSummary is the position of a user across all their groups
+type UserSummary struct {
+	User   primitive.ObjectID `json:"user"`
+	Groups []GroupSummary     `json:"groups"`
+	// Totals are given per currency, amounts in different currencies can not be added up
+	Totals []SummaryTotals `json:"totals"`
+	// Recent are the last transactions involving the user, newest first
+	Recent []Transaction `json:"recent"`
+}
+
+// Summarize returns the summary of a user from their groups and the transactions involving them, newest first.
+// Transactions of other groups are ignored.
+func Summarize(userId primitive.ObjectID, groups []Group, transactions []Transaction, recent int) (UserSummary, error) {
+	summary := UserSummary{
+		User:   userId,
+		Groups: []GroupSummary{},
+		Totals: []SummaryTotals{},
+		Recent: []Transaction{},
+	}
+
+	byGroup := map[primitive.ObjectID][]Transaction{}
+	for _, transaction := range transactions {
+		byGroup[transaction.Group] = append(byGroup[transaction.Group], transaction)
+	}
+
+	totals := map[string]*SummaryTotals{}
+	isGroup := map[primitive.ObjectID]bool{}
+	for _, group := range groups {
+		isGroup[group.Id] = true
+		// the balance of a user only depends on the transactions involving them
+		balances, err := ComputeBalances([]primitive.ObjectID{userId}, byGroup[group.Id])
+		if err != nil {
+			return summary, err
+		}
+		balance := *balances[userId]
+		summary.Groups = append(summary.Groups, GroupSummary{
+			Group:    group.Id,
+			Name:     group.Name,
+			Currency: group.Currency,
+			Balance:  balance,
+		})
+
+		total, ok := totals[group.Currency]
+		if !ok {
+			total = &SummaryTotals{Currency: group.Currency}
+			totals[group.Currency] = total
+		}
+		for _, transaction := range byGroup[group.Id] {
+			if transaction.GetKind() == KindExpense && transaction.PaidBy == userId {
+				total.Spent += int64(transaction.InGroupCurrency(transaction.Amount))
+			}
+		}
+		if balance.TotalAmount < 0 {
+			total.Owed -= int64(balance.TotalAmount)
+		} else {
+			total.Lent += int64(balance.TotalAmount)
+		}
+	}
+
+	for _, transaction := range transactions {
+		if len(summary.Recent) == recent {
+			break
+		}
+		if isGroup[transaction.Group] {
+			summary.Recent = append(summary.Recent, transaction)
+		}
+	}
+
+	for _, total := range totals {
+		summary.Totals = append(summary.Totals, *total)
+	}
+	sort.Slice(summary.Totals, func(i, j int) bool {
+		return summary.Totals[i].Currency < summary.Totals[j].Currency
+	})
+
+	return summary, nil
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSummarize(t *testing.T) {
+	euros := Group{Id: primitive.ObjectID{9}, Name: "trip", Currency: "EUR", Users: []primitive.ObjectID{ann, bob}}
+	dollars := Group{Id: primitive.ObjectID{8}, Name: "flat", Currency: "USD", Users: []primitive.ObjectID{ann, carol}}
+
+	inDollars := func(transaction Transaction) Transaction {
+		transaction.Group = dollars.Id
+		return transaction
+	}
+	converted := expense(ann, 100, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1})
+	converted.Currency = "USD"
+	converted.ExchangeRate = 0.5
+	// newest first
+	transactions := []Transaction{
+		transfer(bob, ann, 40),
+		expense(ann, 80, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: bob, Weight: 1}),
+		converted,
+		inDollars(transfer(ann, carol, 30)),
+		inDollars(expense(carol, 60, &TransactionTarget{User: ann, Weight: 1}, &TransactionTarget{User: carol, Weight: 1})),
+		expense(bob, 20, &TransactionTarget{User: ann, Weight: 1}),
+	}
+
+	summary, err := Summarize(ann, []Group{euros, dollars}, transactions, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SummaryTotals{
+		// the expenses paid by ann, 80 and 100 dollars at 0.5. Her balance, 130 minus her shares and the 40 she received, is 5.
+		{Currency: "EUR", Spent: 130, Lent: 5},
+		// the transfer paid by ann is not spending
+		{Currency: "USD", Spent: 0, Owed: 0},
+	}
+	if len(summary.Totals) != len(want) {
+		t.Fatalf("totals = %+v, want %+v", summary.Totals, want)
+	}
+	for i := range want {
+		if summary.Totals[i] != want[i] {
+			t.Errorf("totals in %s = %+v, want %+v", want[i].Currency, summary.Totals[i], want[i])
+		}
+	}
+	if len(summary.Recent) != 2 || summary.Recent[0].Amount != 40 || summary.Recent[1].Amount != 80 {
+		t.Errorf("recent = %+v, want the 2 newest transactions", summary.Recent)
+	}
+}
@@ -3,11 +3,21 @@ package model
 import (
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type TransactionKind string
+
+const (
+	// KindExpense is money spent on behalf of some members of the group
+	KindExpense TransactionKind = "expense"
+	// KindTransfer is money given by a member to another one, like a reimbursement
+	KindTransfer TransactionKind = "transfer"
+)
+
 type TransactionTarget struct {
 	User          primitive.ObjectID `json:"user" bson:"user"`
 	ForcePrice    uint32             `json:"forcePrice,omitempty" bson:"forcePrice,omitempty"`
@@ -18,12 +28,23 @@ type TransactionTarget struct {
 type Transaction struct {
 	Id       primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	Group    primitive.ObjectID   `json:"group" bson:"group,omitempty"`
+	Kind     TransactionKind      `json:"kind,omitempty" bson:"kind,omitempty"`
 	PaidBy   primitive.ObjectID   `json:"paidBy" bson:"paidBy,omitempty"`
 	PaidFor  []*TransactionTarget `json:"paidFor" bson:"paidFor,omitempty"`
 	Amount   uint32               `json:"amount" bson:"amount,omitempty"`
 	Date     time.Time            `json:"date" bson:"date,omitempty"`
 	Category string               `json:"category" bson:"category,omitempty"`
 	Title    string               `json:"title,omitempty" bson:"title,omitempty"`
+	// Currency of Amount and of the prices of PaidFor, the group currency when empty
+	Currency string `json:"currency,omitempty" bson:"currency,omitempty"`
+	// ExchangeRate is the value of one unit of Currency in the group currency
+	ExchangeRate float64 `json:"exchangeRate,omitempty" bson:"exchangeRate,omitempty"`
+	// DeletedAt is set when the transaction is in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Recurring is the recurring transaction that created this transaction, if any
+	Recurring *primitive.ObjectID `json:"recurring,omitempty" bson:"recurring,omitempty"`
+	// Version is incremented by every change to the transaction, it is sent as the ETag of the transaction
+	Version uint32 `json:"version" bson:"version"`
 }
 
 func (s *Transaction) Validate() (err error) {
@@ -42,13 +63,81 @@ func (s *Transaction) Validate() (err error) {
 	if s.Date.IsZero() {
 		return fmt.Errorf(`field "date" must have be filled`)
 	}
-	if s.Category == "" {
-		return fmt.Errorf(`field "category" must have be filled`)
+	if s.Currency != "" && !IsCurrencyCode(s.Currency) {
+		return fmt.Errorf(`field "currency" must be a 3 letters currency code`)
+	}
+	if s.ExchangeRate < 0 {
+		return fmt.Errorf(`field "exchangeRate" must be positive`)
+	}
+	switch s.GetKind() {
+	case KindExpense:
+		if s.Category == "" {
+			return fmt.Errorf(`field "category" must have be filled`)
+		}
+	case KindTransfer:
+		if len(s.PaidFor) != 1 {
+			return fmt.Errorf(`field "paidFor" must have exactly one value for a transfer`)
+		}
+		if s.PaidFor[0].User == s.PaidBy {
+			return fmt.Errorf(`a transfer must be paid for someone else than "paidBy"`)
+		}
+	default:
+		return fmt.Errorf(`field "kind" must be either "%s" or "%s"`, KindExpense, KindTransfer)
+	}
+
+	return nil
+}
+
+// GetKind returns the kind of the transaction, transactions without a kind are expenses
+func (s *Transaction) GetKind() TransactionKind {
+	if s.Kind == "" {
+		return KindExpense
 	}
+	return s.Kind
+}
 
+// ResolveExchangeRate sets the currency and exchange rate of the transaction for the given group.
+// A rate sent by the client is kept, otherwise it is taken from the group exchange rates.
+func (s *Transaction) ResolveExchangeRate(group *Group) error {
+	if s.Currency == "" || s.Currency == group.Currency {
+		s.Currency = group.Currency
+		s.ExchangeRate = 1
+		return nil
+	}
+	if s.ExchangeRate != 0 {
+		return nil
+	}
+	rate, ok := group.ExchangeRates[s.Currency]
+	if !ok {
+		return fmt.Errorf(`field "exchangeRate" must be filled, the group has no exchange rate for "%s"`, s.Currency)
+	}
+	s.ExchangeRate = rate
 	return nil
 }
 
+// InGroupCurrency converts an amount of the transaction currency into the group currency
+func (s *Transaction) InGroupCurrency(amount uint32) uint32 {
+	if s.ExchangeRate == 0 || s.ExchangeRate == 1 {
+		return amount
+	}
+	return uint32(math.Round(float64(amount) * s.ExchangeRate))
+}
+
+// Involves reports whether the user paid or benefited from the transaction
+func (s *Transaction) Involves(userId primitive.ObjectID) bool {
+	return s.PaidBy == userId || s.IsPaidFor(userId)
+}
+
+// IsPaidFor reports whether the user benefited from the transaction
+func (s *Transaction) IsPaidFor(userId primitive.ObjectID) bool {
+	for _, paidFor := range s.PaidFor {
+		if paidFor.User == userId {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Transaction) Users() []primitive.ObjectID {
 	users := map[primitive.ObjectID]bool{s.PaidBy: true}
 	for _, paidFor := range s.PaidFor {
@@ -64,16 +153,32 @@ func (s *Transaction) Users() []primitive.ObjectID {
 }
 
 func (s *Transaction) ComputePrices() (err error) {
+	// the receiver of a transfer gets the whole amount
+	if s.GetKind() == KindTransfer {
+		for _, t := range s.PaidFor {
+			t.ComputedPrice = s.Amount
+		}
+		return nil
+	}
+
 	rest := s.Amount
-	totalWeights := uint32(0)
+	// weights and their products with amounts do not fit in 32 bits
+	totalWeights := uint64(0)
 	for _, t := range s.PaidFor {
 		if t.ForcePrice > rest {
 			return errors.New("force prices are higher than the transaction amount, please fix")
 		}
 		rest -= t.ForcePrice
-		totalWeights += t.Weight
+		totalWeights += uint64(t.Weight)
+	}
+	if rest != 0 && totalWeights == 0 {
+		return errors.New("force prices are lower than the transaction amount and no one has a weight to pay the rest, please fix")
 	}
 	if rest == 0 {
+		// prices left by a previous computation must not survive an update
+		for _, t := range s.PaidFor {
+			t.ComputedPrice = t.ForcePrice
+		}
 		return nil
 	}
 
@@ -85,18 +190,29 @@ func (s *Transaction) ComputePrices() (err error) {
 			t.ComputedPrice = t.ForcePrice
 		}
 		if t.Weight != 0 {
-			part := toSplit * t.Weight / totalWeights
+			part := uint32(uint64(toSplit) * uint64(t.Weight) / totalWeights)
 			t.ComputedPrice += part
 			rest -= part
 		}
 	}
 
-	// if part of the amount could not be parted between members, increment each person computed price by the smallest unit
-	if rest > 0 {
-		for _, t := range s.PaidFor {
-			t.ComputedPrice += 1
+	// the units left by rounding the parts down go to the first weighted members, one each,
+	// so that the prices add up to the amount
+	for _, t := range s.PaidFor {
+		if rest == 0 {
+			break
+		}
+		if t.Weight != 0 {
+			t.ComputedPrice++
+			rest--
 		}
 	}
 
 	return nil
 }
+
+// TransactionMatch is a transaction found by a search, the higher the score the better the match
+type TransactionMatch struct {
+	Transaction `bson:",inline"`
+	Score       float64 `json:"score" bson:"score"`
+}
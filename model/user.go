@@ -5,4 +5,17 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 type User struct {
 	Id   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name string             `json:"name" bson:"name,omitempty"`
+	// Email identifies the account of the user, users created by someone else have none.
+	// It is only sent to the user themselves.
+	Email        string `json:"email,omitempty" bson:"email,omitempty"`
+	PasswordHash []byte `json:"-" bson:"passwordHash,omitempty"`
+	// CreatedBy is the user who created a user without an account, see HasAccount
+	CreatedBy *primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	// Version is incremented by every change to the user, it is sent as the ETag of the user
+	Version uint32 `json:"version" bson:"version"`
+}
+
+// HasAccount reports whether the user can log in
+func (u *User) HasAccount() bool {
+	return len(u.PasswordHash) != 0
 }
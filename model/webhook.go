@@ -0,0 +1,177 @@
+package model
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEvents are the events that can be sent to webhooks, the changes of transactions and of members
+var WebhookEvents = []EventType{
+	EventTransactionCreated,
+	EventTransactionUpdated,
+	EventTransactionDeleted,
+	EventTransactionRestored,
+	EventMembersChanged,
+}
+
+// WebhookMaxAttempts is how many times a delivery is attempted before it fails
+const WebhookMaxAttempts = 8
+
+// minSecretLength keeps the signatures from being guessed
+const minSecretLength = 16
+
+// Webhook is a URL the events of a group are sent to, signed with its secret
+type Webhook struct {
+	Id    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Group primitive.ObjectID `json:"group" bson:"group"`
+	URL   string             `json:"url" bson:"url"`
+	// Secret signs the deliveries, it is only sent back when the webhook is created or given a new secret
+	Secret string `json:"secret,omitempty" bson:"secret"`
+	// Events limits the events sent to the webhook, all of WebhookEvents are sent when empty
+	Events    []EventType        `json:"events,omitempty" bson:"events,omitempty"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// Version is incremented by every change, it is sent as the ETag of the webhook
+	Version uint32 `json:"version" bson:"version"`
+}
+
+// IsPublicAddress reports whether deliveries can be sent to ip. Loopback, private and link-local addresses
+// are refused, so that webhooks can not reach the services next to the API, like the metadata of a cloud instance.
+func IsPublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// Validate checks the webhook, resolving the host of its URL within ctx unless allowPrivate lets it be any address
+func (w *Webhook) Validate(ctx context.Context, allowPrivate bool) error {
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf(`field "url" must be an absolute http or https URL`)
+	}
+	if len(w.Secret) < minSecretLength {
+		return fmt.Errorf(`field "secret" must have at least %d characters`, minSecretLength)
+	}
+	for _, event := range w.Events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf(`field "events" must only have events of transactions and "%s"`, EventMembersChanged)
+		}
+	}
+	if !allowPrivate {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+		if err != nil {
+			return fmt.Errorf(`field "url" must have a host that can be resolved`)
+		}
+		for _, addr := range addrs {
+			if !IsPublicAddress(addr.IP) {
+				return fmt.Errorf(`field "url" must not point to a loopback, private or link-local address`)
+			}
+		}
+	}
+	return nil
+}
+
+func isWebhookEvent(eventType EventType) bool {
+	for _, other := range WebhookEvents {
+		if other == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts reports whether an event of the given type is sent to the webhook
+func (w *Webhook) Accepts(eventType EventType) bool {
+	if !isWebhookEvent(eventType) {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, other := range w.Events {
+		if other == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature of a delivery sent at the given time: the hex HMAC-SHA256, keyed by the secret,
+// of the unix timestamp, a dot and the body. Receivers compute it again to check where the delivery comes from.
+func (w *Webhook) Sign(timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookAttempt is a request sent to a webhook
+type WebhookAttempt struct {
+	Time time.Time `json:"time" bson:"time"`
+	// StatusCode is the status of the response, it is empty when there was none
+	StatusCode int `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	// Error tells why the attempt failed
+	Error    string `json:"error,omitempty" bson:"error,omitempty"`
+	Duration int64  `json:"durationMs" bson:"durationMs"`
+}
+
+// WebhookDelivery sends an event to a webhook, until it succeeds or runs out of attempts
+type WebhookDelivery struct {
+	Id      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Webhook primitive.ObjectID `json:"webhook" bson:"webhook"`
+	Group   primitive.ObjectID `json:"group" bson:"group"`
+	Event   Event              `json:"event" bson:"event"`
+	Status  DeliveryStatus     `json:"status" bson:"status"`
+	// ReplayOf is the delivery this one sends again
+	ReplayOf  *primitive.ObjectID `json:"replayOf,omitempty" bson:"replayOf,omitempty"`
+	Attempts  []WebhookAttempt    `json:"attempts" bson:"attempts"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	// NextAttempt is when the delivery is attempted again, there is none left when it is empty
+	NextAttempt *time.Time `json:"nextAttempt,omitempty" bson:"nextAttempt,omitempty"`
+}
+
+// NewWebhookDelivery returns a pending delivery of an event, to attempt at once
+func NewWebhookDelivery(webhook *Webhook, event Event, now time.Time) WebhookDelivery {
+	return WebhookDelivery{
+		Webhook:     webhook.Id,
+		Group:       webhook.Group,
+		Event:       event,
+		Status:      DeliveryPending,
+		Attempts:    []WebhookAttempt{},
+		CreatedAt:   now,
+		NextAttempt: &now,
+	}
+}
+
+// Record adds an attempt to the delivery and schedules the next one. Failed attempts are retried with an
+// exponential backoff: retryDelay after the first one, twice as long after the second one, and so on.
+func (d *WebhookDelivery) Record(attempt WebhookAttempt, retryDelay time.Duration) {
+	d.Attempts = append(d.Attempts, attempt)
+	d.NextAttempt = nil
+	switch {
+	case attempt.Error == "":
+		d.Status = DeliverySucceeded
+	case len(d.Attempts) >= WebhookMaxAttempts:
+		d.Status = DeliveryFailed
+	default:
+		next := attempt.Time.Add(retryDelay << (len(d.Attempts) - 1))
+		d.NextAttempt = &next
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		valid        bool
+	}{
+		{"https://93.184.216.34/hook", false, true},
+		{"ftp://93.184.216.34/hook", false, false},
+		{"/hook", false, false},
+		{"http://127.0.0.1:8080/hook", false, false},
+		{"http://localhost/hook", false, false},
+		{"http://[::1]/hook", false, false},
+		{"http://10.1.2.3/hook", false, false},
+		{"http://192.168.0.10/hook", false, false},
+		{"http://172.16.0.1/hook", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"http://[fe80::1]/hook", false, false},
+		{"http://0.0.0.0/hook", false, false},
+		{"http://[::ffff:127.0.0.1]/hook", false, false},
+		{"http://127.0.0.1:8080/hook", true, true},
+		{"http://169.254.169.254/latest/meta-data", true, true},
+	}
+	for _, test := range tests {
+		webhook := Webhook{URL: test.url, Secret: "0123456789abcdef"}
+		if err := webhook.Validate(context.Background(), test.allowPrivate); (err == nil) != test.valid {
+			t.Errorf("Validate(%s, allowPrivate %v) = %v, want valid %v", test.url, test.allowPrivate, err, test.valid)
+		}
+	}
+
+	// resolving the host stops with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	webhook := Webhook{URL: "https://example.com/hook", Secret: "0123456789abcdef"}
+	if err := webhook.Validate(ctx, false); err == nil {
+		t.Error("Validate with a cancelled context resolved the host")
+	}
+}
+
+func TestWebhookDeliveryRecord(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	delivery := NewWebhookDelivery(&Webhook{}, Event{}, start)
+
+	now := start
+	wait := time.Minute
+	for i := 1; i < WebhookMaxAttempts; i++ {
+		delivery.Record(WebhookAttempt{Time: now, StatusCode: 500, Error: "status 500"}, time.Minute)
+		if delivery.Status != DeliveryPending || delivery.NextAttempt == nil {
+			t.Fatalf("attempt %d: status %s, next attempt %v, want another attempt", i, delivery.Status, delivery.NextAttempt)
+		}
+		if got := delivery.NextAttempt.Sub(now); got != wait {
+			t.Fatalf("attempt %d: next attempt after %s, want %s", i, got, wait)
+		}
+		now = *delivery.NextAttempt
+		wait *= 2
+	}
+	delivery.Record(WebhookAttempt{Time: now, Error: "timeout"}, time.Minute)
+	if delivery.Status != DeliveryFailed || delivery.NextAttempt != nil {
+		t.Errorf("status %s, next attempt %v after %d attempts, want failed", delivery.Status, delivery.NextAttempt, len(delivery.Attempts))
+	}
+
+	succeeded := NewWebhookDelivery(&Webhook{}, Event{}, start)
+	succeeded.Record(WebhookAttempt{Time: start, Error: "status 502"}, time.Minute)
+	succeeded.Record(WebhookAttempt{Time: start.Add(time.Minute), StatusCode: 204}, time.Minute)
+	if succeeded.Status != DeliverySucceeded || succeeded.NextAttempt != nil {
+		t.Errorf("status %s, next attempt %v, want succeeded", succeeded.Status, succeeded.NextAttempt)
+	}
+}
+
+func TestWebhookSign(t *testing.T) {
+	webhook := Webhook{Secret: "It's a Secret to Everybody"}
+	// computed with: printf '1700000000.Hello, World!' | openssl dgst -sha256 -hmac "It's a Secret to Everybody"
+	want := "76c83fd0acdf22faed320674fe8e04d528cfe8a17905e720a9611e40677c03b7"
+	if got := webhook.Sign(time.Unix(1700000000, 0), []byte("Hello, World!")); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
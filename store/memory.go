@@ -0,0 +1,949 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryStore struct {
+	users        *memoryUsers
+	groups       *memoryGroups
+	transactions *memoryTransactions
+	stats        *memoryStats
+	sessions     *memorySessions
+	invitations  *memoryInvitations
+	history      *memoryHistory
+	idempotency  *memoryIdempotentRequests
+	recurring    *memoryRecurringTransactions
+	webhooks     *memoryWebhooks
+	deliveries   *memoryWebhookDeliveries
+
+	// txMu serializes transactions
+	txMu sync.Mutex
+}
+
+// NewMemory returns an empty Store keeping everything in memory, meant for tests and local demos
+func NewMemory() Store {
+	return &memoryStore{
+		users:        &memoryUsers{newMemoryCollection[model.User]()},
+		groups:       &memoryGroups{newMemoryCollection[model.Group]()},
+		transactions: &memoryTransactions{newMemoryCollection[model.Transaction]()},
+		stats:        &memoryStats{calls: map[string]int64{}},
+		sessions:     &memorySessions{newMemoryCollection[model.Session]()},
+		invitations:  &memoryInvitations{newMemoryCollection[model.Invitation]()},
+		history:      &memoryHistory{newMemoryCollection[model.HistoryEntry]()},
+		idempotency:  &memoryIdempotentRequests{requests: map[string]model.IdempotentRequest{}},
+		recurring:    &memoryRecurringTransactions{newMemoryCollection[model.RecurringTransaction]()},
+		webhooks:     &memoryWebhooks{newMemoryCollection[model.Webhook]()},
+		deliveries:   &memoryWebhookDeliveries{newMemoryCollection[model.WebhookDelivery]()},
+	}
+}
+
+func (s *memoryStore) Users() UserStore                                 { return s.users }
+func (s *memoryStore) Groups() GroupStore                               { return s.groups }
+func (s *memoryStore) Transactions() TransactionStore                   { return s.transactions }
+func (s *memoryStore) Stats() StatsStore                                { return s.stats }
+func (s *memoryStore) Sessions() SessionStore                           { return s.sessions }
+func (s *memoryStore) Invitations() InvitationStore                     { return s.invitations }
+func (s *memoryStore) History() HistoryStore                            { return s.history }
+func (s *memoryStore) IdempotentRequests() IdempotentRequestStore       { return s.idempotency }
+func (s *memoryStore) RecurringTransactions() RecurringTransactionStore { return s.recurring }
+func (s *memoryStore) Webhooks() WebhookStore                           { return s.webhooks }
+func (s *memoryStore) WebhookDeliveries() WebhookDeliveryStore          { return s.deliveries }
+
+// EnsureIndexes has nothing to do, documents are always scanned
+func (s *memoryStore) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+type memoryTxKey struct{}
+
+// memoryTx is the undo log of a transaction, the writes made with its context record how to undo them
+type memoryTx struct {
+	mu   sync.Mutex
+	undo []func()
+}
+
+func (tx *memoryTx) add(undo func()) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.undo = append(tx.undo, undo)
+}
+
+// WithTransaction undoes the writes of fn when it fails, the writes made meanwhile outside of the transaction are kept.
+// Transactions are serialized but not isolated from calls made outside of a transaction.
+func (s *memoryStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	tx := &memoryTx{}
+	err := fn(context.WithValue(ctx, memoryTxKey{}, tx))
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}
+	return err
+}
+
+// memoryCollection keeps documents as BSON so that stored values never alias
+// the caller's and behave exactly like they would after a round-trip to Mongo
+type memoryCollection[T any] struct {
+	mu   sync.RWMutex
+	docs map[primitive.ObjectID][]byte
+}
+
+func newMemoryCollection[T any]() *memoryCollection[T] {
+	return &memoryCollection[T]{docs: map[primitive.ObjectID][]byte{}}
+}
+
+// find returns the documents accepted by match, ordered by id
+func (c *memoryCollection[T]) find(match func(*T) bool) ([]T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]primitive.ObjectID, 0, len(c.docs))
+	for id := range c.docs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+
+	out := []T{}
+	for _, id := range ids {
+		var doc T
+		if err := bson.Unmarshal(c.docs[id], &doc); err != nil {
+			return nil, err
+		}
+		if match == nil || match(&doc) {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+func reverse[T any](docs []T) {
+	for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+		docs[i], docs[j] = docs[j], docs[i]
+	}
+}
+
+// without returns ids without the given id
+func without(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	out := []primitive.ObjectID{}
+	for _, other := range ids {
+		if other != id {
+			out = append(out, other)
+		}
+	}
+	return out
+}
+
+func (c *memoryCollection[T]) get(id primitive.ObjectID) (T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var doc T
+	raw, ok := c.docs[id]
+	if !ok {
+		return doc, ErrNotFound
+	}
+	err := bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// logUndo records how to undo a write to the document with the given id when ctx belongs to a transaction,
+// it must be called with the lock held before the write
+func (c *memoryCollection[T]) logUndo(ctx context.Context, id primitive.ObjectID) {
+	tx, ok := ctx.Value(memoryTxKey{}).(*memoryTx)
+	if !ok {
+		return
+	}
+	raw, existed := c.docs[id]
+	tx.add(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if existed {
+			c.docs[id] = raw
+		} else {
+			delete(c.docs, id)
+		}
+	})
+}
+
+// put stores doc under id. When replace is true, the document must already exist.
+func (c *memoryCollection[T]) put(ctx context.Context, id primitive.ObjectID, doc *T, replace bool) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; replace && !ok {
+		return ErrNotFound
+	}
+	c.logUndo(ctx, id)
+	c.docs[id] = raw
+	return nil
+}
+
+// insert stores doc under id, which must not be used
+func (c *memoryCollection[T]) insert(ctx context.Context, id primitive.ObjectID, doc *T) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; ok {
+		return ErrAlreadyExists
+	}
+	c.logUndo(ctx, id)
+	c.docs[id] = raw
+	return nil
+}
+
+// insertUnique stores doc under id, which must not be used, unless conflicts accepts one of the stored documents
+func (c *memoryCollection[T]) insertUnique(ctx context.Context, id primitive.ObjectID, doc *T, conflicts func(*T) bool) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; ok {
+		return ErrAlreadyExists
+	}
+	for _, other := range c.docs {
+		var stored T
+		if err := bson.Unmarshal(other, &stored); err != nil {
+			return err
+		}
+		if conflicts(&stored) {
+			return ErrAlreadyExists
+		}
+	}
+	c.logUndo(ctx, id)
+	c.docs[id] = raw
+	return nil
+}
+
+// update atomically applies change to the document with the given id
+func (c *memoryCollection[T]) update(ctx context.Context, id primitive.ObjectID, change func(*T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, ok := c.docs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	var doc T
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	if err := change(&doc); err != nil {
+		return err
+	}
+	raw, err := bson.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	c.logUndo(ctx, id)
+	c.docs[id] = raw
+	return nil
+}
+
+// deleteWhere deletes the documents accepted by match
+func (c *memoryCollection[T]) deleteWhere(ctx context.Context, match func(*T) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, raw := range c.docs {
+		var doc T
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		if match(&doc) {
+			c.logUndo(ctx, id)
+			delete(c.docs, id)
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection[T]) delete(ctx context.Context, id primitive.ObjectID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; ok {
+		c.logUndo(ctx, id)
+		delete(c.docs, id)
+	}
+}
+
+type memoryUsers struct {
+	*memoryCollection[model.User]
+}
+
+func (s *memoryUsers) List(ctx context.Context, filter UserFilter) ([]model.User, error) {
+	var re *regexp.Regexp
+	if filter.Name != "" {
+		var err error
+		re, err = regexp.Compile("(?i)" + filter.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids := map[primitive.ObjectID]bool{}
+	for _, id := range filter.Ids {
+		ids[id] = true
+	}
+	users, err := s.find(func(u *model.User) bool {
+		if re != nil && !re.MatchString(u.Name) {
+			return false
+		}
+		return len(ids) == 0 || ids[u.Id]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userSortFields.paginate(users, filter.Page), nil
+}
+
+func (s *memoryUsers) Get(ctx context.Context, id primitive.ObjectID) (model.User, error) {
+	return s.get(id)
+}
+
+func (s *memoryUsers) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	users, err := s.find(func(u *model.User) bool {
+		return u.Email == email
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	if len(users) == 0 {
+		return model.User{}, ErrNotFound
+	}
+	return users[0], nil
+}
+
+func (s *memoryUsers) Count(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		if _, ok := s.docs[id]; ok {
+			seen[id] = true
+		}
+	}
+	return int64(len(seen)), nil
+}
+
+// sameEmail returns a function accepting the other users with the email of user, like the unique index of Mongo
+func sameEmail(user *model.User) func(*model.User) bool {
+	return func(other *model.User) bool {
+		return user.Email != "" && other.Email == user.Email
+	}
+}
+
+func (s *memoryUsers) Insert(ctx context.Context, user *model.User) error {
+	user.Id = primitive.NewObjectID()
+	user.Version = 1
+	return s.insertUnique(ctx, user.Id, user, sameEmail(user))
+}
+
+func (s *memoryUsers) InsertWithId(ctx context.Context, user *model.User) error {
+	return s.insertUnique(ctx, user.Id, user, sameEmail(user))
+}
+
+func (s *memoryUsers) Replace(ctx context.Context, user *model.User) error {
+	return s.update(ctx, user.Id, func(stored *model.User) error {
+		if stored.Version != user.Version {
+			return ErrVersionConflict
+		}
+		user.Version++
+		*stored = *user
+		return nil
+	})
+}
+
+func (s *memoryUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+type memoryGroups struct {
+	*memoryCollection[model.Group]
+}
+
+func (s *memoryGroups) List(ctx context.Context, filter GroupFilter) ([]model.Group, error) {
+	groups, err := s.find(func(g *model.Group) bool {
+		if !filter.Deletion.match(g.DeletedAt, filter.DeletedBefore) {
+			return false
+		}
+		if filter.User.IsZero() || g.HasMember(filter.User) {
+			return true
+		}
+		if filter.IncludeFormerUsers {
+			for _, userId := range g.FormerUsers {
+				if userId == filter.User {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groupSortFields.paginate(groups, filter.Page), nil
+}
+
+func (s *memoryGroups) Get(ctx context.Context, id primitive.ObjectID) (model.Group, error) {
+	return s.get(id)
+}
+
+func (s *memoryGroups) Insert(ctx context.Context, group *model.Group) error {
+	group.Id = primitive.NewObjectID()
+	group.Version = 1
+	return s.put(ctx, group.Id, group, false)
+}
+
+func (s *memoryGroups) InsertWithId(ctx context.Context, group *model.Group) error {
+	return s.insert(ctx, group.Id, group)
+}
+
+func (s *memoryGroups) Replace(ctx context.Context, group *model.Group) error {
+	return s.update(ctx, group.Id, func(stored *model.Group) error {
+		if stored.Version != group.Version {
+			return ErrVersionConflict
+		}
+		group.Version++
+		*stored = *group
+		return nil
+	})
+}
+
+func (s *memoryGroups) AddMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) error {
+	return s.update(ctx, id, func(g *model.Group) error {
+		if !g.HasMember(userId) {
+			g.Users = append(g.Users, userId)
+		}
+		g.FormerUsers = without(g.FormerUsers, userId)
+		g.Version++
+		return nil
+	})
+}
+
+func (s *memoryGroups) RemoveMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID, keepAsFormer bool) error {
+	return s.update(ctx, id, func(g *model.Group) error {
+		g.Users = without(g.Users, userId)
+		roles := []model.GroupRole{}
+		for _, role := range g.Roles {
+			if role.User != userId {
+				roles = append(roles, role)
+			}
+		}
+		g.Roles = roles
+		if keepAsFormer {
+			g.FormerUsers = append(without(g.FormerUsers, userId), userId)
+		}
+		g.Version++
+		return nil
+	})
+}
+
+func (s *memoryGroups) SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error {
+	return s.update(ctx, id, func(g *model.Group) error {
+		if g.Version != version {
+			return ErrVersionConflict
+		}
+		g.DeletedAt = deletedAt
+		g.Version++
+		return nil
+	})
+}
+
+func (s *memoryGroups) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+type memoryTransactions struct {
+	*memoryCollection[model.Transaction]
+}
+
+func (s *memoryTransactions) List(ctx context.Context, filter TransactionFilter) ([]model.Transaction, error) {
+	transactions, err := s.find(func(t *model.Transaction) bool {
+		if !filter.Group.IsZero() && t.Group != filter.Group {
+			return false
+		}
+		if !filter.User.IsZero() && !t.Involves(filter.User) {
+			return false
+		}
+		if !filter.Deletion.match(t.DeletedAt, filter.DeletedBefore) {
+			return false
+		}
+		if !filter.PaidBy.IsZero() && t.PaidBy != filter.PaidBy {
+			return false
+		}
+		if !filter.Participant.IsZero() && !t.IsPaidFor(filter.Participant) {
+			return false
+		}
+		if filter.Category != "" && t.Category != filter.Category {
+			return false
+		}
+		if !filter.DateFrom.IsZero() && t.Date.Before(filter.DateFrom) {
+			return false
+		}
+		if !filter.DateTo.IsZero() && !t.Date.Before(filter.DateTo) {
+			return false
+		}
+		if t.Amount < filter.AmountMin || (filter.AmountMax != 0 && t.Amount > filter.AmountMax) {
+			return false
+		}
+		if !filter.Recurring.IsZero() && (t.Recurring == nil || *t.Recurring != filter.Recurring) {
+			return false
+		}
+		return filter.Kind == "" || t.GetKind() == filter.Kind
+	})
+	if err != nil {
+		return nil, err
+	}
+	// newest first by default, like the mongo implementation
+	page := filter.Page
+	if page.Sort == "" {
+		page.Sort, page.Descending = SortCreated, true
+	}
+	return transactionSortFields.paginate(transactions, page), nil
+}
+
+func (s *memoryTransactions) Get(ctx context.Context, id primitive.ObjectID) (model.Transaction, error) {
+	return s.get(id)
+}
+
+func (s *memoryTransactions) Search(ctx context.Context, groupId primitive.ObjectID, text string, limit int) ([]model.TransactionMatch, error) {
+	search := parseTextSearch(text)
+	transactions, err := s.find(func(t *model.Transaction) bool {
+		return t.Group == groupId && t.DeletedAt == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []model.TransactionMatch{}
+	// newest first among equal scores
+	for i := len(transactions) - 1; i >= 0; i-- {
+		if score := search.score(&transactions[i]); score > 0 {
+			matches = append(matches, model.TransactionMatch{Transaction: transactions[i], Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (s *memoryTransactions) Stats(ctx context.Context, groupId primitive.ObjectID, biggest int) (model.GroupStats, error) {
+	transactions, err := s.find(func(t *model.Transaction) bool {
+		return t.Group == groupId && t.DeletedAt == nil
+	})
+	if err != nil {
+		return model.GroupStats{}, err
+	}
+	return model.ComputeGroupStats(transactions, biggest), nil
+}
+
+func (s *memoryTransactions) Insert(ctx context.Context, transaction *model.Transaction) error {
+	transaction.Id = primitive.NewObjectID()
+	transaction.Version = 1
+	return s.put(ctx, transaction.Id, transaction, false)
+}
+
+func (s *memoryTransactions) InsertWithId(ctx context.Context, transaction *model.Transaction) error {
+	return s.insert(ctx, transaction.Id, transaction)
+}
+
+func (s *memoryTransactions) Replace(ctx context.Context, transaction *model.Transaction) error {
+	return s.update(ctx, transaction.Id, func(stored *model.Transaction) error {
+		if stored.Version != transaction.Version {
+			return ErrVersionConflict
+		}
+		transaction.Version++
+		*stored = *transaction
+		return nil
+	})
+}
+
+func (s *memoryTransactions) SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error {
+	return s.update(ctx, id, func(t *model.Transaction) error {
+		if t.Version != version {
+			return ErrVersionConflict
+		}
+		t.DeletedAt = deletedAt
+		t.Version++
+		return nil
+	})
+}
+
+func (s *memoryTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+func (s *memoryTransactions) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(t *model.Transaction) bool {
+		return t.Group == groupId
+	})
+}
+
+type memoryStats struct {
+	mu    sync.Mutex
+	calls map[string]int64
+}
+
+func (s *memoryStats) IncrementCalls(ctx context.Context, path string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[path]++
+	return s.calls[path], nil
+}
+
+type memorySessions struct {
+	*memoryCollection[model.Session]
+}
+
+func (s *memorySessions) Get(ctx context.Context, tokenHash string) (model.Session, error) {
+	sessions, err := s.find(func(session *model.Session) bool {
+		return session.TokenHash == tokenHash
+	})
+	if err != nil {
+		return model.Session{}, err
+	}
+	if len(sessions) == 0 {
+		return model.Session{}, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+func (s *memorySessions) Insert(ctx context.Context, session *model.Session) error {
+	session.Id = primitive.NewObjectID()
+	return s.put(ctx, session.Id, session, false)
+}
+
+func (s *memorySessions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+func (s *memorySessions) DeleteForUser(ctx context.Context, userId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(session *model.Session) bool {
+		return session.User == userId
+	})
+}
+
+type memoryInvitations struct {
+	*memoryCollection[model.Invitation]
+}
+
+func (s *memoryInvitations) List(ctx context.Context, groupId primitive.ObjectID) ([]model.Invitation, error) {
+	invitations, err := s.find(func(i *model.Invitation) bool {
+		return i.Group == groupId
+	})
+	if err != nil {
+		return nil, err
+	}
+	reverse(invitations)
+	return invitations, nil
+}
+
+func (s *memoryInvitations) Get(ctx context.Context, id primitive.ObjectID) (model.Invitation, error) {
+	return s.get(id)
+}
+
+func (s *memoryInvitations) GetByToken(ctx context.Context, tokenHash string) (model.Invitation, error) {
+	invitations, err := s.find(func(i *model.Invitation) bool {
+		return i.TokenHash == tokenHash
+	})
+	if err != nil {
+		return model.Invitation{}, err
+	}
+	if len(invitations) == 0 {
+		return model.Invitation{}, ErrNotFound
+	}
+	return invitations[0], nil
+}
+
+func (s *memoryInvitations) Insert(ctx context.Context, invitation *model.Invitation) error {
+	invitation.Id = primitive.NewObjectID()
+	return s.put(ctx, invitation.Id, invitation, false)
+}
+
+func (s *memoryInvitations) Replace(ctx context.Context, invitation *model.Invitation) error {
+	return s.put(ctx, invitation.Id, invitation, true)
+}
+
+func (s *memoryInvitations) Use(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return s.update(ctx, id, func(i *model.Invitation) error {
+		if !i.Usable(now) {
+			return ErrNotFound
+		}
+		i.Uses++
+		return nil
+	})
+}
+
+func (s *memoryInvitations) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(i *model.Invitation) bool {
+		return i.Group == groupId
+	})
+}
+
+type memoryHistory struct {
+	*memoryCollection[model.HistoryEntry]
+}
+
+func (s *memoryHistory) List(ctx context.Context, filter HistoryFilter) ([]model.HistoryEntry, error) {
+	entries, err := s.find(func(e *model.HistoryEntry) bool {
+		if !filter.Group.IsZero() && e.Group != filter.Group {
+			return false
+		}
+		return filter.EntityId.IsZero() || e.EntityId == filter.EntityId
+	})
+	if err != nil {
+		return nil, err
+	}
+	reverse(entries)
+	return entries, nil
+}
+
+func (s *memoryHistory) Insert(ctx context.Context, entry *model.HistoryEntry) error {
+	entry.Id = primitive.NewObjectID()
+	return s.put(ctx, entry.Id, entry, false)
+}
+
+// memoryIdempotentRequests is keyed by strings, unlike memoryCollection
+type memoryIdempotentRequests struct {
+	mu       sync.Mutex
+	requests map[string]model.IdempotentRequest
+}
+
+func (s *memoryIdempotentRequests) Get(ctx context.Context, key string) (model.IdempotentRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[key]
+	if !ok || request.Expired(time.Now()) {
+		return model.IdempotentRequest{}, ErrNotFound
+	}
+	return request, nil
+}
+
+func (s *memoryIdempotentRequests) Insert(ctx context.Context, request *model.IdempotentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.requests[request.Key]; ok && !stored.Expired(time.Now()) {
+		return ErrAlreadyExists
+	}
+	s.requests[request.Key] = *request
+	return nil
+}
+
+func (s *memoryIdempotentRequests) Replace(ctx context.Context, request *model.IdempotentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.requests[request.Key]; !ok {
+		return ErrNotFound
+	}
+	s.requests[request.Key] = *request
+	return nil
+}
+
+func (s *memoryIdempotentRequests) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.requests, key)
+	return nil
+}
+
+func (s *memoryIdempotentRequests) DeleteExpired(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, request := range s.requests {
+		if request.Expired(now) {
+			delete(s.requests, key)
+		}
+	}
+	return nil
+}
+
+type memoryRecurringTransactions struct {
+	*memoryCollection[model.RecurringTransaction]
+}
+
+func (s *memoryRecurringTransactions) List(ctx context.Context, groupId primitive.ObjectID) ([]model.RecurringTransaction, error) {
+	return s.find(func(r *model.RecurringTransaction) bool {
+		return r.Group == groupId
+	})
+}
+
+func (s *memoryRecurringTransactions) ListDue(ctx context.Context, now time.Time) ([]model.RecurringTransaction, error) {
+	return s.find(func(r *model.RecurringTransaction) bool {
+		return r.NextDate != nil && !r.NextDate.After(now)
+	})
+}
+
+func (s *memoryRecurringTransactions) Get(ctx context.Context, id primitive.ObjectID) (model.RecurringTransaction, error) {
+	return s.get(id)
+}
+
+func (s *memoryRecurringTransactions) Insert(ctx context.Context, recurring *model.RecurringTransaction) error {
+	recurring.Id = primitive.NewObjectID()
+	recurring.Version = 1
+	return s.put(ctx, recurring.Id, recurring, false)
+}
+
+func (s *memoryRecurringTransactions) Replace(ctx context.Context, recurring *model.RecurringTransaction) error {
+	return s.update(ctx, recurring.Id, func(stored *model.RecurringTransaction) error {
+		if stored.Version != recurring.Version {
+			return ErrVersionConflict
+		}
+		recurring.Version++
+		*stored = *recurring
+		return nil
+	})
+}
+
+func (s *memoryRecurringTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+func (s *memoryRecurringTransactions) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(r *model.RecurringTransaction) bool {
+		return r.Group == groupId
+	})
+}
+
+type memoryWebhooks struct {
+	*memoryCollection[model.Webhook]
+}
+
+func (s *memoryWebhooks) List(ctx context.Context, groupId primitive.ObjectID) ([]model.Webhook, error) {
+	return s.find(func(w *model.Webhook) bool {
+		return w.Group == groupId
+	})
+}
+
+func (s *memoryWebhooks) Get(ctx context.Context, id primitive.ObjectID) (model.Webhook, error) {
+	return s.get(id)
+}
+
+func (s *memoryWebhooks) Insert(ctx context.Context, webhook *model.Webhook) error {
+	webhook.Id = primitive.NewObjectID()
+	webhook.Version = 1
+	return s.put(ctx, webhook.Id, webhook, false)
+}
+
+func (s *memoryWebhooks) Replace(ctx context.Context, webhook *model.Webhook) error {
+	return s.update(ctx, webhook.Id, func(stored *model.Webhook) error {
+		if stored.Version != webhook.Version {
+			return ErrVersionConflict
+		}
+		webhook.Version++
+		*stored = *webhook
+		return nil
+	})
+}
+
+func (s *memoryWebhooks) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.delete(ctx, id)
+	return nil
+}
+
+func (s *memoryWebhooks) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(w *model.Webhook) bool {
+		return w.Group == groupId
+	})
+}
+
+type memoryWebhookDeliveries struct {
+	*memoryCollection[model.WebhookDelivery]
+}
+
+func (s *memoryWebhookDeliveries) List(ctx context.Context, webhookId primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	deliveries, err := s.find(func(d *model.WebhookDelivery) bool {
+		return d.Webhook == webhookId
+	})
+	if err != nil {
+		return nil, err
+	}
+	reverse(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *memoryWebhookDeliveries) ListDue(ctx context.Context, now time.Time) ([]model.WebhookDelivery, error) {
+	return s.find(func(d *model.WebhookDelivery) bool {
+		return d.NextAttempt != nil && !d.NextAttempt.After(now)
+	})
+}
+
+func (s *memoryWebhookDeliveries) Get(ctx context.Context, id primitive.ObjectID) (model.WebhookDelivery, error) {
+	return s.get(id)
+}
+
+func (s *memoryWebhookDeliveries) Insert(ctx context.Context, delivery *model.WebhookDelivery) error {
+	delivery.Id = primitive.NewObjectID()
+	return s.put(ctx, delivery.Id, delivery, false)
+}
+
+func (s *memoryWebhookDeliveries) Replace(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return s.put(ctx, delivery.Id, delivery, true)
+}
+
+func (s *memoryWebhookDeliveries) DeleteForWebhook(ctx context.Context, webhookId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(d *model.WebhookDelivery) bool {
+		return d.Webhook == webhookId
+	})
+}
+
+func (s *memoryWebhookDeliveries) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return s.deleteWhere(ctx, func(d *model.WebhookDelivery) bool {
+		return d.Group == groupId
+	})
+}
+
+func (s *memoryWebhookDeliveries) DeleteFinished(ctx context.Context, before time.Time) error {
+	return s.deleteWhere(ctx, func(d *model.WebhookDelivery) bool {
+		return d.NextAttempt == nil && d.CreatedAt.Before(before)
+	})
+}
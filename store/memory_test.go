@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/triplan-planning/api-go/model"
+)
+
+func TestMemoryWithTransaction(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	kept := model.Group{Name: "kept"}
+	if err := s.Groups().Insert(ctx, &kept); err != nil {
+		t.Fatal(err)
+	}
+
+	var undone, outside model.Group
+	failure := errors.New("failure")
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		undone = model.Group{Name: "undone"}
+		if err := s.Groups().Insert(ctx, &undone); err != nil {
+			return err
+		}
+		kept.Name = "renamed"
+		if err := s.Groups().Replace(ctx, &kept); err != nil {
+			return err
+		}
+		if err := s.Groups().Delete(ctx, kept.Id); err != nil {
+			return err
+		}
+		// a write made meanwhile by a request outside of the transaction
+		outside = model.Group{Name: "outside"}
+		if err := s.Groups().Insert(context.Background(), &outside); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithTransaction returned %v, want %v", err, failure)
+	}
+
+	if group, err := s.Groups().Get(ctx, kept.Id); err != nil || group.Name != "kept" {
+		t.Errorf("the group changed by the transaction is %+v, %v, want it as it was before", group, err)
+	}
+	if _, err := s.Groups().Get(ctx, undone.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the group inserted by the transaction: %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.Groups().Get(ctx, outside.Id); err != nil {
+		t.Errorf("the group inserted outside of the transaction: %v", err)
+	}
+}
+
+func TestMemorySetDeletedAtVersion(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	group := model.Group{Name: "trip"}
+	if err := s.Groups().Insert(ctx, &group); err != nil {
+		t.Fatal(err)
+	}
+	read := group
+	group.Name = "renamed"
+	if err := s.Groups().Replace(ctx, &group); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := s.Groups().SetDeletedAt(ctx, group.Id, read.Version, &now); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("moving a group changed since it was read to the trash: %v, want %v", err, ErrVersionConflict)
+	}
+	if err := s.Groups().SetDeletedAt(ctx, group.Id, group.Version, &now); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Groups().Get(ctx, group.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DeletedAt == nil || stored.Version != group.Version+1 {
+		t.Errorf("group moved to the trash = %+v, want version %d", stored, group.Version+1)
+	}
+}
+
+func TestMemoryInvitationUse(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	now := time.Now()
+	invitation := model.Invitation{MaxUses: 3}
+	if err := s.Invitations().Insert(ctx, &invitation); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent joins can not go over the maximum uses
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Invitations().Use(ctx, invitation.Id, now); err == nil {
+				mu.Lock()
+				used++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if used != 3 {
+		t.Errorf("%d uses of an invitation with 3 uses", used)
+	}
+
+	expired := model.Invitation{ExpiresAt: &now}
+	revoked := model.Invitation{RevokedAt: &now}
+	for _, invitation := range []*model.Invitation{&expired, &revoked} {
+		if err := s.Invitations().Insert(ctx, invitation); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Invitations().Use(ctx, invitation.Id, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("use of %+v: %v, want %v", invitation, err, ErrNotFound)
+		}
+	}
+}
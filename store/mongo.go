@@ -0,0 +1,1005 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	client       *mongo.Client
+	users        *mongoUsers
+	groups       *mongoGroups
+	transactions *mongoTransactions
+	stats        *mongoStats
+	sessions     *mongoSessions
+	invitations  *mongoInvitations
+	history      *mongoHistory
+	idempotency  *mongoIdempotentRequests
+	recurring    *mongoRecurringTransactions
+	webhooks     *mongoWebhooks
+	deliveries   *mongoWebhookDeliveries
+}
+
+// NewMongo returns a Store backed by the "triplan" database of the given client
+func NewMongo(db *mongo.Client) Store {
+	return &mongoStore{
+		client:       db,
+		users:        &mongoUsers{coll: db.Database("triplan").Collection("users")},
+		groups:       &mongoGroups{coll: db.Database("triplan").Collection("groups")},
+		transactions: &mongoTransactions{coll: db.Database("triplan").Collection("transactions")},
+		stats:        &mongoStats{coll: db.Database("stats").Collection("http_calls")},
+		sessions:     &mongoSessions{coll: db.Database("triplan").Collection("sessions")},
+		invitations:  &mongoInvitations{coll: db.Database("triplan").Collection("invitations")},
+		history:      &mongoHistory{coll: db.Database("triplan").Collection("history")},
+		idempotency:  &mongoIdempotentRequests{coll: db.Database("triplan").Collection("idempotent_requests")},
+		recurring:    &mongoRecurringTransactions{coll: db.Database("triplan").Collection("recurring_transactions")},
+		webhooks:     &mongoWebhooks{coll: db.Database("triplan").Collection("webhooks")},
+		deliveries:   &mongoWebhookDeliveries{coll: db.Database("triplan").Collection("webhook_deliveries")},
+	}
+}
+
+func (s *mongoStore) Users() UserStore                                 { return s.users }
+func (s *mongoStore) Groups() GroupStore                               { return s.groups }
+func (s *mongoStore) Transactions() TransactionStore                   { return s.transactions }
+func (s *mongoStore) Stats() StatsStore                                { return s.stats }
+func (s *mongoStore) Sessions() SessionStore                           { return s.sessions }
+func (s *mongoStore) Invitations() InvitationStore                     { return s.invitations }
+func (s *mongoStore) History() HistoryStore                            { return s.history }
+func (s *mongoStore) IdempotentRequests() IdempotentRequestStore       { return s.idempotency }
+func (s *mongoStore) RecurringTransactions() RecurringTransactionStore { return s.recurring }
+func (s *mongoStore) Webhooks() WebhookStore                           { return s.webhooks }
+func (s *mongoStore) WebhookDeliveries() WebhookDeliveryStore          { return s.deliveries }
+
+// WithTransaction needs MongoDB to run as a replica set
+func (s *mongoStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+func (s *mongoStore) EnsureIndexes(ctx context.Context) error {
+	// users without an account have no email, the sparse index leaves them out
+	_, err := s.users.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	// every authenticated request looks its session up
+	_, err = s.sessions.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	// joining a group looks its invitation up
+	_, err = s.invitations.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tokenHash", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := bson.D{}
+	weights := bson.M{}
+	for _, field := range transactionTextFields {
+		keys = append(keys, bson.E{Key: field.bson, Value: "text"})
+		weights[field.bson] = field.weight
+	}
+	// stemming would depend on the language of each group
+	_, err = s.transactions.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName("transactions_text").SetWeights(weights).SetDefaultLanguage("none"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the scheduler looks for due recurring transactions every minute
+	_, err = s.recurring.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "nextDate", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// deliveries are looked for by the scheduler and the purge, and listed newest first in the delivery log of their webhook
+	_, err = s.deliveries.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "nextAttempt", Value: 1}}},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+// findOne decodes the document with the given id into out, translating a missing document into ErrNotFound
+func findOne(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, out any) error {
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func replaceOne(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, doc any) error {
+	res, err := coll.ReplaceOne(ctx, bson.M{"_id": id}, doc)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// replaceVersioned replaces the document with the given id if its version is still version.
+// Documents stored before versions existed have none and match version 0.
+func replaceVersioned(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, version uint32, doc any) error {
+	res, err := coll.ReplaceOne(ctx, versionQuery(id, version), doc)
+	if err != nil {
+		return err
+	}
+	return versionedResult(ctx, coll, id, res)
+}
+
+// updateVersioned is replaceVersioned for an update
+func updateVersioned(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, version uint32, update any) error {
+	res, err := coll.UpdateOne(ctx, versionQuery(id, version), update)
+	if err != nil {
+		return err
+	}
+	return versionedResult(ctx, coll, id, res)
+}
+
+// versionQuery matches the document with the given id and version, documents stored before versions have none
+func versionQuery(id primitive.ObjectID, version uint32) bson.M {
+	query := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		query["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return query
+}
+
+// versionedResult tells whether the document of a versioned write was missing or had another version
+func versionedResult(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, res *mongo.UpdateResult) error {
+	if res.MatchedCount == 1 {
+		return nil
+	}
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// insertWithId inserts a document that has its id, translating a used id into ErrAlreadyExists
+func insertWithId(ctx context.Context, coll *mongo.Collection, doc any) error {
+	_, err := coll.InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func updateOne(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, update any) error {
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func deleteOne(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID) error {
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func setDeletedAt(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, version uint32, deletedAt *time.Time) error {
+	if deletedAt == nil {
+		return updateVersioned(ctx, coll, id, version, bson.M{"$unset": bson.M{"deletedAt": ""}, "$inc": bson.M{"version": 1}})
+	}
+	return updateVersioned(ctx, coll, id, version, bson.M{"$set": bson.M{"deletedAt": deletedAt}, "$inc": bson.M{"version": 1}})
+}
+
+// deletionQuery returns the condition on "deletedAt" matching d, see Deletion.match
+func deletionQuery(d Deletion, before time.Time) any {
+	switch d {
+	case NotDeleted:
+		return bson.M{"$exists": false}
+	case Deleted:
+		if before.IsZero() {
+			return bson.M{"$exists": true}
+		}
+		return bson.M{"$lt": before}
+	default:
+		return nil
+	}
+}
+
+// addCondition adds a condition to query, which may already have conditions on the same fields
+func addCondition(query bson.M, condition bson.M) {
+	if condition == nil {
+		return
+	}
+	conditions, _ := query["$and"].(bson.A)
+	query["$and"] = append(conditions, condition)
+}
+
+// rangeQuery returns the condition on a field between from and to, using the given operator for to.
+// Zero bounds are ignored, nil is returned when both are.
+func rangeQuery[T comparable](from T, to T, toOperator string) bson.M {
+	var zero T
+	condition := bson.M{}
+	if from != zero {
+		condition["$gte"] = from
+	}
+	if to != zero {
+		condition[toOperator] = to
+	}
+	if len(condition) == 0 {
+		return nil
+	}
+	return condition
+}
+
+func deleteMany(ctx context.Context, coll *mongo.Collection, filter bson.M) error {
+	_, err := coll.DeleteMany(ctx, filter)
+	return err
+}
+
+type mongoUsers struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoUsers) List(ctx context.Context, filter UserFilter) ([]model.User, error) {
+	query := bson.M{}
+	if filter.Name != "" {
+		query["name"] = primitive.Regex{Pattern: filter.Name, Options: "i"}
+	}
+	if len(filter.Ids) > 0 {
+		query["_id"] = bson.M{"$in": filter.Ids}
+	}
+	after, opts := userSortFields.mongoPage(filter.Page)
+	addCondition(query, after)
+
+	res, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []model.User{}
+	err = res.All(ctx, &users)
+	return users, err
+}
+
+func (s *mongoUsers) Get(ctx context.Context, id primitive.ObjectID) (model.User, error) {
+	var user model.User
+	err := findOne(ctx, s.coll, id, &user)
+	return user, err
+}
+
+func (s *mongoUsers) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	var user model.User
+	err := s.coll.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (s *mongoUsers) Count(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	return s.coll.CountDocuments(ctx, bson.M{
+		"_id": bson.M{"$in": ids},
+	})
+}
+
+func (s *mongoUsers) Insert(ctx context.Context, user *model.User) error {
+	user.Id = primitive.NilObjectID
+	user.Version = 1
+	res, err := s.coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	user.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoUsers) InsertWithId(ctx context.Context, user *model.User) error {
+	return insertWithId(ctx, s.coll, user)
+}
+
+func (s *mongoUsers) Replace(ctx context.Context, user *model.User) error {
+	user.Version++
+	err := replaceVersioned(ctx, s.coll, user.Id, user.Version-1, user)
+	if err != nil {
+		user.Version--
+	}
+	return err
+}
+
+func (s *mongoUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+type mongoGroups struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoGroups) List(ctx context.Context, filter GroupFilter) ([]model.Group, error) {
+	query := bson.M{}
+	if !filter.User.IsZero() && filter.IncludeFormerUsers {
+		query["$or"] = bson.A{
+			bson.M{"users": filter.User},
+			bson.M{"formerUsers": filter.User},
+		}
+	} else if !filter.User.IsZero() {
+		query["users"] = filter.User
+	}
+	if deleted := deletionQuery(filter.Deletion, filter.DeletedBefore); deleted != nil {
+		query["deletedAt"] = deleted
+	}
+	after, opts := groupSortFields.mongoPage(filter.Page)
+	addCondition(query, after)
+
+	res, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []model.Group{}
+	err = res.All(ctx, &groups)
+	return groups, err
+}
+
+func (s *mongoGroups) Get(ctx context.Context, id primitive.ObjectID) (model.Group, error) {
+	var group model.Group
+	err := findOne(ctx, s.coll, id, &group)
+	return group, err
+}
+
+func (s *mongoGroups) Insert(ctx context.Context, group *model.Group) error {
+	group.Id = primitive.NilObjectID
+	group.Version = 1
+	res, err := s.coll.InsertOne(ctx, group)
+	if err != nil {
+		return err
+	}
+	group.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoGroups) InsertWithId(ctx context.Context, group *model.Group) error {
+	return insertWithId(ctx, s.coll, group)
+}
+
+func (s *mongoGroups) Replace(ctx context.Context, group *model.Group) error {
+	group.Version++
+	err := replaceVersioned(ctx, s.coll, group.Id, group.Version-1, group)
+	if err != nil {
+		group.Version--
+	}
+	return err
+}
+
+func (s *mongoGroups) AddMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) error {
+	return updateOne(ctx, s.coll, id, bson.M{
+		"$addToSet": bson.M{"users": userId},
+		"$pull":     bson.M{"formerUsers": userId},
+		"$inc":      bson.M{"version": 1},
+	})
+}
+
+func (s *mongoGroups) RemoveMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID, keepAsFormer bool) error {
+	update := bson.M{
+		"$pull": bson.M{
+			"users": userId,
+			"roles": bson.M{"user": userId},
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	if keepAsFormer {
+		update["$addToSet"] = bson.M{"formerUsers": userId}
+	}
+	return updateOne(ctx, s.coll, id, update)
+}
+
+func (s *mongoGroups) SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error {
+	return setDeletedAt(ctx, s.coll, id, version, deletedAt)
+}
+
+func (s *mongoGroups) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+type mongoTransactions struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoTransactions) List(ctx context.Context, filter TransactionFilter) ([]model.Transaction, error) {
+	query := bson.M{}
+	if !filter.Group.IsZero() {
+		query["group"] = filter.Group
+	}
+	if !filter.User.IsZero() {
+		query["$or"] = bson.A{
+			bson.M{"paidBy": filter.User},
+			bson.M{"paidFor.user": filter.User},
+		}
+	}
+	if deleted := deletionQuery(filter.Deletion, filter.DeletedBefore); deleted != nil {
+		query["deletedAt"] = deleted
+	}
+	if filter.Kind == model.KindExpense {
+		query["kind"] = bson.M{"$in": bson.A{model.KindExpense, nil}}
+	} else if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+	if !filter.PaidBy.IsZero() {
+		query["paidBy"] = filter.PaidBy
+	}
+	if !filter.Participant.IsZero() {
+		query["paidFor.user"] = filter.Participant
+	}
+	if filter.Category != "" {
+		query["category"] = filter.Category
+	}
+	if dates := rangeQuery(filter.DateFrom, filter.DateTo, "$lt"); dates != nil {
+		query["date"] = dates
+	}
+	if amounts := rangeQuery(filter.AmountMin, filter.AmountMax, "$lte"); amounts != nil {
+		query["amount"] = amounts
+	}
+	if !filter.Recurring.IsZero() {
+		query["recurring"] = filter.Recurring
+	}
+
+	page := filter.Page
+	if page.Sort == "" {
+		page.Sort, page.Descending = SortCreated, true
+	}
+	after, opts := transactionSortFields.mongoPage(page)
+	addCondition(query, after)
+
+	res, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []model.Transaction{}
+	err = res.All(ctx, &transactions)
+	return transactions, err
+}
+
+func (s *mongoTransactions) Get(ctx context.Context, id primitive.ObjectID) (model.Transaction, error) {
+	var transaction model.Transaction
+	err := findOne(ctx, s.coll, id, &transaction)
+	return transaction, err
+}
+
+func (s *mongoTransactions) Search(ctx context.Context, groupId primitive.ObjectID, text string, limit int) ([]model.TransactionMatch, error) {
+	query := bson.M{
+		"group":     groupId,
+		"deletedAt": deletionQuery(NotDeleted, time.Time{}),
+		"$text":     bson.M{"$search": text},
+	}
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	res, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []model.TransactionMatch{}
+	err = res.All(ctx, &matches)
+	return matches, err
+}
+
+// inGroupCurrency converts an amount like model.Transaction.InGroupCurrency does
+func inGroupCurrency(amount string) bson.M {
+	rate := bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$exchangeRate", 0}}, 0}},
+		"$exchangeRate",
+		1,
+	}}
+	// math.Round rounds half away from zero, $round rounds half to even
+	rounded := bson.M{"$floor": bson.M{"$add": bson.A{
+		bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{amount, 0}}, rate}},
+		0.5,
+	}}}
+	return bson.M{"$toLong": rounded}
+}
+
+// statsTotals returns the stages summing the amounts of the transactions grouped by key, see model.StatsTotal
+func statsTotals(key any, amount any, sort bson.D) bson.A {
+	return bson.A{
+		bson.M{"$group": bson.M{
+			"_id":   key,
+			"total": bson.M{"$sum": amount},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": sort},
+	}
+}
+
+func (s *mongoTransactions) Stats(ctx context.Context, groupId primitive.ObjectID, biggest int) (model.GroupStats, error) {
+	byTotal := bson.D{{Key: "total", Value: -1}, {Key: "_id", Value: 1}}
+	byPeriod := bson.D{{Key: "_id", Value: 1}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"group":     groupId,
+			"deletedAt": deletionQuery(NotDeleted, time.Time{}),
+			"kind":      bson.M{"$in": bson.A{model.KindExpense, nil}},
+		}}},
+		{{Key: "$addFields", Value: bson.M{"value": inGroupCurrency("$amount")}}},
+		{{Key: "$facet", Value: bson.M{
+			"totals":     statsTotals(nil, "$value", byTotal),
+			"byCategory": statsTotals(bson.M{"$ifNull": bson.A{"$category", ""}}, "$value", byTotal),
+			"byPayer":    statsTotals("$paidBy", "$value", byTotal),
+			"byParticipant": append(
+				bson.A{bson.M{"$unwind": "$paidFor"}},
+				statsTotals("$paidFor.user", inGroupCurrency("$paidFor.computedPrice"), byTotal)...,
+			),
+			"byDay":  statsTotals(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$date"}}, "$value", byPeriod),
+			"byWeek": statsTotals(bson.M{"$dateToString": bson.M{"format": "%G-W%V", "date": "$date"}}, "$value", byPeriod),
+		}}},
+	}
+	// $limit must be positive
+	if biggest > 0 {
+		facets := pipeline[2][0].Value.(bson.M)
+		facets["biggest"] = bson.A{
+			bson.M{"$sort": bson.D{{Key: "value", Value: -1}, {Key: "_id", Value: -1}}},
+			bson.M{"$limit": biggest},
+			bson.M{"$project": bson.M{"value": 0}},
+		}
+	}
+
+	res, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return model.GroupStats{}, err
+	}
+	var results []struct {
+		Totals           []model.StatsTotal `bson:"totals"`
+		model.GroupStats `bson:",inline"`
+	}
+	if err := res.All(ctx, &results); err != nil {
+		return model.GroupStats{}, err
+	}
+	// $facet always returns one document
+	stats := results[0].GroupStats
+	if stats.Biggest == nil {
+		stats.Biggest = []model.Transaction{}
+	}
+	if len(results[0].Totals) != 0 {
+		stats.StatsTotal = results[0].Totals[0]
+	}
+	return stats, nil
+}
+
+func (s *mongoTransactions) Insert(ctx context.Context, transaction *model.Transaction) error {
+	transaction.Id = primitive.NilObjectID
+	transaction.Version = 1
+	res, err := s.coll.InsertOne(ctx, transaction)
+	if err != nil {
+		return err
+	}
+	transaction.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoTransactions) InsertWithId(ctx context.Context, transaction *model.Transaction) error {
+	return insertWithId(ctx, s.coll, transaction)
+}
+
+func (s *mongoTransactions) Replace(ctx context.Context, transaction *model.Transaction) error {
+	transaction.Version++
+	err := replaceVersioned(ctx, s.coll, transaction.Id, transaction.Version-1, transaction)
+	if err != nil {
+		transaction.Version--
+	}
+	return err
+}
+
+func (s *mongoTransactions) SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error {
+	return setDeletedAt(ctx, s.coll, id, version, deletedAt)
+}
+
+func (s *mongoTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+func (s *mongoTransactions) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"group": groupId})
+}
+
+type mongoStats struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoStats) IncrementCalls(ctx context.Context, path string) (int64, error) {
+	res := s.coll.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": path},
+		bson.M{"$inc": bson.M{"count": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	var out struct {
+		Count int64 `bson:"count"`
+	}
+	err := res.Decode(&out)
+	return out.Count, err
+}
+
+type mongoSessions struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoSessions) Get(ctx context.Context, tokenHash string) (model.Session, error) {
+	var session model.Session
+	err := s.coll.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return session, ErrNotFound
+	}
+	return session, err
+}
+
+func (s *mongoSessions) Insert(ctx context.Context, session *model.Session) error {
+	session.Id = primitive.NilObjectID
+	res, err := s.coll.InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+	session.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoSessions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+func (s *mongoSessions) DeleteForUser(ctx context.Context, userId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"user": userId})
+}
+
+type mongoInvitations struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoInvitations) List(ctx context.Context, groupId primitive.ObjectID) ([]model.Invitation, error) {
+	res, err := s.coll.Find(ctx, bson.M{"group": groupId}, options.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := []model.Invitation{}
+	err = res.All(ctx, &invitations)
+	return invitations, err
+}
+
+func (s *mongoInvitations) Get(ctx context.Context, id primitive.ObjectID) (model.Invitation, error) {
+	var invitation model.Invitation
+	err := findOne(ctx, s.coll, id, &invitation)
+	return invitation, err
+}
+
+func (s *mongoInvitations) GetByToken(ctx context.Context, tokenHash string) (model.Invitation, error) {
+	var invitation model.Invitation
+	err := s.coll.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&invitation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return invitation, ErrNotFound
+	}
+	return invitation, err
+}
+
+func (s *mongoInvitations) Insert(ctx context.Context, invitation *model.Invitation) error {
+	invitation.Id = primitive.NilObjectID
+	res, err := s.coll.InsertOne(ctx, invitation)
+	if err != nil {
+		return err
+	}
+	invitation.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoInvitations) Replace(ctx context.Context, invitation *model.Invitation) error {
+	return replaceOne(ctx, s.coll, invitation.Id, invitation)
+}
+
+func (s *mongoInvitations) Use(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	// the filter makes the check and the increment atomic, as model.Invitation.Usable
+	res, err := s.coll.UpdateOne(ctx, bson.M{
+		"_id":       id,
+		"revokedAt": bson.M{"$exists": false},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"expiresAt": bson.M{"$exists": false}},
+				bson.M{"expiresAt": bson.M{"$gt": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"maxUses": bson.M{"$exists": false}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}},
+			}},
+		},
+	}, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoInvitations) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"group": groupId})
+}
+
+type mongoHistory struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoHistory) List(ctx context.Context, filter HistoryFilter) ([]model.HistoryEntry, error) {
+	query := bson.M{}
+	if !filter.Group.IsZero() {
+		query["group"] = filter.Group
+	}
+	if !filter.EntityId.IsZero() {
+		query["entityId"] = filter.EntityId
+	}
+
+	res, err := s.coll.Find(ctx, query, options.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []model.HistoryEntry{}
+	err = res.All(ctx, &entries)
+	return entries, err
+}
+
+func (s *mongoHistory) Insert(ctx context.Context, entry *model.HistoryEntry) error {
+	entry.Id = primitive.NilObjectID
+	res, err := s.coll.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+type mongoIdempotentRequests struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoIdempotentRequests) Get(ctx context.Context, key string) (model.IdempotentRequest, error) {
+	var request model.IdempotentRequest
+	err := s.coll.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&request)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return request, ErrNotFound
+	}
+	return request, err
+}
+
+func (s *mongoIdempotentRequests) Insert(ctx context.Context, request *model.IdempotentRequest) error {
+	// the key is the id of the document, an expired request must go before it can be reused
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": request.Key, "expiresAt": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return err
+	}
+	_, err = s.coll.InsertOne(ctx, request)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *mongoIdempotentRequests) Replace(ctx context.Context, request *model.IdempotentRequest) error {
+	res, err := s.coll.ReplaceOne(ctx, bson.M{"_id": request.Key}, request)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoIdempotentRequests) Delete(ctx context.Context, key string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (s *mongoIdempotentRequests) DeleteExpired(ctx context.Context, now time.Time) error {
+	return deleteMany(ctx, s.coll, bson.M{"expiresAt": bson.M{"$lte": now}})
+}
+
+type mongoRecurringTransactions struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoRecurringTransactions) find(ctx context.Context, query bson.M) ([]model.RecurringTransaction, error) {
+	res, err := s.coll.Find(ctx, query, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	recurring := []model.RecurringTransaction{}
+	err = res.All(ctx, &recurring)
+	return recurring, err
+}
+
+func (s *mongoRecurringTransactions) List(ctx context.Context, groupId primitive.ObjectID) ([]model.RecurringTransaction, error) {
+	return s.find(ctx, bson.M{"group": groupId})
+}
+
+func (s *mongoRecurringTransactions) ListDue(ctx context.Context, now time.Time) ([]model.RecurringTransaction, error) {
+	return s.find(ctx, bson.M{"nextDate": bson.M{"$lte": now}})
+}
+
+func (s *mongoRecurringTransactions) Get(ctx context.Context, id primitive.ObjectID) (model.RecurringTransaction, error) {
+	var recurring model.RecurringTransaction
+	err := findOne(ctx, s.coll, id, &recurring)
+	return recurring, err
+}
+
+func (s *mongoRecurringTransactions) Insert(ctx context.Context, recurring *model.RecurringTransaction) error {
+	recurring.Id = primitive.NilObjectID
+	recurring.Version = 1
+	res, err := s.coll.InsertOne(ctx, recurring)
+	if err != nil {
+		return err
+	}
+	recurring.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoRecurringTransactions) Replace(ctx context.Context, recurring *model.RecurringTransaction) error {
+	recurring.Version++
+	err := replaceVersioned(ctx, s.coll, recurring.Id, recurring.Version-1, recurring)
+	if err != nil {
+		recurring.Version--
+	}
+	return err
+}
+
+func (s *mongoRecurringTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+func (s *mongoRecurringTransactions) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"group": groupId})
+}
+
+type mongoWebhooks struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoWebhooks) List(ctx context.Context, groupId primitive.ObjectID) ([]model.Webhook, error) {
+	res, err := s.coll.Find(ctx, bson.M{"group": groupId}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []model.Webhook{}
+	err = res.All(ctx, &webhooks)
+	return webhooks, err
+}
+
+func (s *mongoWebhooks) Get(ctx context.Context, id primitive.ObjectID) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := findOne(ctx, s.coll, id, &webhook)
+	return webhook, err
+}
+
+func (s *mongoWebhooks) Insert(ctx context.Context, webhook *model.Webhook) error {
+	webhook.Id = primitive.NilObjectID
+	webhook.Version = 1
+	res, err := s.coll.InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+	webhook.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoWebhooks) Replace(ctx context.Context, webhook *model.Webhook) error {
+	webhook.Version++
+	err := replaceVersioned(ctx, s.coll, webhook.Id, webhook.Version-1, webhook)
+	if err != nil {
+		webhook.Version--
+	}
+	return err
+}
+
+func (s *mongoWebhooks) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.coll, id)
+}
+
+func (s *mongoWebhooks) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"group": groupId})
+}
+
+type mongoWebhookDeliveries struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoWebhookDeliveries) find(ctx context.Context, query bson.M, opts *options.FindOptions) ([]model.WebhookDelivery, error) {
+	res, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	err = res.All(ctx, &deliveries)
+	return deliveries, err
+}
+
+func (s *mongoWebhookDeliveries) List(ctx context.Context, webhookId primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	return s.find(ctx, bson.M{"webhook": webhookId}, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+}
+
+func (s *mongoWebhookDeliveries) ListDue(ctx context.Context, now time.Time) ([]model.WebhookDelivery, error) {
+	return s.find(ctx, bson.M{"nextAttempt": bson.M{"$lte": now}}, options.Find().SetSort(bson.M{"_id": 1}))
+}
+
+func (s *mongoWebhookDeliveries) Get(ctx context.Context, id primitive.ObjectID) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := findOne(ctx, s.coll, id, &delivery)
+	return delivery, err
+}
+
+func (s *mongoWebhookDeliveries) Insert(ctx context.Context, delivery *model.WebhookDelivery) error {
+	delivery.Id = primitive.NilObjectID
+	res, err := s.coll.InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+	delivery.Id = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoWebhookDeliveries) Replace(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return replaceOne(ctx, s.coll, delivery.Id, delivery)
+}
+
+func (s *mongoWebhookDeliveries) DeleteForWebhook(ctx context.Context, webhookId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"webhook": webhookId})
+}
+
+func (s *mongoWebhookDeliveries) DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error {
+	return deleteMany(ctx, s.coll, bson.M{"group": groupId})
+}
+
+func (s *mongoWebhookDeliveries) DeleteFinished(ctx context.Context, before time.Time) error {
+	return deleteMany(ctx, s.coll, bson.M{"nextAttempt": bson.M{"$exists": false}, "createdAt": bson.M{"$lt": before}})
+}
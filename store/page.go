@@ -0,0 +1,206 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fields lists can be sorted by
+const (
+	SortCreated = "created"
+	SortDate    = "date"
+	SortAmount  = "amount"
+	SortName    = "name"
+)
+
+// Page selects a part of a sorted list. The zero value selects the whole list in the default order of the store.
+type Page struct {
+	// Sort is one of the Sort constants supported by the listed documents, ties are broken by id
+	Sort       string
+	Descending bool
+	// After only keeps the documents following the one it was made from, see TransactionCursor
+	After *Cursor
+	// Limit is the maximum number of documents returned, 0 for no limit
+	Limit int
+}
+
+// Cursor is the position of a document in a list sorted by some field
+type Cursor struct {
+	// Value is the value of the sort field of the document
+	Value any                `bson:"value"`
+	Id    primitive.ObjectID `bson:"id"`
+}
+
+// sortFields maps the Sort constants to the fields of the documents, and gives their value in a document
+type sortFields[T any] map[string]struct {
+	bson  string
+	value func(*T) any
+}
+
+var userSortFields = sortFields[model.User]{
+	SortCreated: {"_id", func(u *model.User) any { return u.Id }},
+	SortName:    {"name", func(u *model.User) any { return u.Name }},
+}
+
+var groupSortFields = sortFields[model.Group]{
+	SortCreated: {"_id", func(g *model.Group) any { return g.Id }},
+	SortName:    {"name", func(g *model.Group) any { return g.Name }},
+}
+
+var transactionSortFields = sortFields[model.Transaction]{
+	SortCreated: {"_id", func(t *model.Transaction) any { return t.Id }},
+	SortDate:    {"date", func(t *model.Transaction) any { return t.Date }},
+	SortAmount:  {"amount", func(t *model.Transaction) any { return t.Amount }},
+}
+
+func (f sortFields[T]) cursor(doc *T, sort string) Cursor {
+	field, ok := f[sort]
+	if !ok {
+		field = f[SortCreated]
+	}
+	return Cursor{Value: field.value(doc), Id: f.id(doc)}
+}
+
+func (f sortFields[T]) id(doc *T) primitive.ObjectID {
+	return f[SortCreated].value(doc).(primitive.ObjectID)
+}
+
+// UserCursor returns the cursor of a user in a list sorted by the given field
+func UserCursor(user *model.User, sort string) Cursor {
+	return userSortFields.cursor(user, sort)
+}
+
+// GroupCursor returns the cursor of a group in a list sorted by the given field
+func GroupCursor(group *model.Group, sort string) Cursor {
+	return groupSortFields.cursor(group, sort)
+}
+
+// TransactionCursor returns the cursor of a transaction in a list sorted by the given field
+func TransactionCursor(transaction *model.Transaction, sort string) Cursor {
+	return transactionSortFields.cursor(transaction, sort)
+}
+
+// mongoPage returns the condition selecting the documents after the cursor of page, if any,
+// and the options sorting and limiting the result
+func (f sortFields[T]) mongoPage(page Page) (bson.M, *options.FindOptions) {
+	field, ok := f[page.Sort]
+	if !ok {
+		field = f[SortCreated]
+	}
+	direction, after := 1, "$gt"
+	if page.Descending {
+		direction, after = -1, "$lt"
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: field.bson, Value: direction}, {Key: "_id", Value: direction}})
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit))
+	}
+
+	if page.After == nil {
+		return nil, opts
+	}
+	if field.bson == "_id" {
+		return bson.M{"_id": bson.M{after: page.After.Id}}, opts
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field.bson: bson.M{after: page.After.Value}},
+		bson.M{field.bson: page.After.Value, "_id": bson.M{after: page.After.Id}},
+	}}, opts
+}
+
+// paginate sorts docs and returns those selected by page, like mongoPage
+func (f sortFields[T]) paginate(docs []T, page Page) []T {
+	field, ok := f[page.Sort]
+	if !ok {
+		field = f[SortCreated]
+	}
+	less := func(a *T, b *T) bool {
+		if c := compareValues(field.value(a), field.value(b)); c != 0 {
+			return c < 0
+		}
+		return compareValues(f.id(a), f.id(b)) < 0
+	}
+	if page.Descending {
+		ascending := less
+		less = func(a *T, b *T) bool { return ascending(b, a) }
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return less(&docs[i], &docs[j])
+	})
+
+	if page.After != nil {
+		start := len(docs)
+		for i := range docs {
+			c := compareValues(field.value(&docs[i]), page.After.Value)
+			if c == 0 {
+				c = compareValues(f.id(&docs[i]), page.After.Id)
+			}
+			if page.Descending {
+				c = -c
+			}
+			if c > 0 {
+				start = i
+				break
+			}
+		}
+		docs = docs[start:]
+	}
+
+	if page.Limit > 0 && len(docs) > page.Limit {
+		docs = docs[:page.Limit]
+	}
+	return docs
+}
+
+// compareValues compares two values of a sort field, which may have been decoded from BSON
+// with another type than the one of the field
+func compareValues(a any, b any) int {
+	a, b = sortable(a), sortable(b)
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+		return -1
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+		return 1
+	}
+	return 0
+}
+
+// sortable turns the numbers and dates into an int64, and the ids into a string
+func sortable(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UnixMilli()
+	case primitive.DateTime:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case primitive.ObjectID:
+		return v.Hex()
+	}
+	return v
+}
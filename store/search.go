@@ -0,0 +1,63 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/triplan-planning/api-go/model"
+)
+
+// transactionTextFields are the fields searched by TransactionStore.Search, a match in a field
+// counts as much as its weight in the score
+var transactionTextFields = []struct {
+	bson   string
+	weight int32
+	value  func(*model.Transaction) string
+}{
+	{"title", 3, func(t *model.Transaction) string { return t.Title }},
+	{"category", 1, func(t *model.Transaction) string { return t.Category }},
+}
+
+// words splits a text into lower case words
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// textSearch is a search text parsed like MongoDB does for $text queries, without the phrases:
+// documents must contain one of the terms and none of the terms prefixed by "-"
+type textSearch struct {
+	terms    map[string]bool
+	excluded map[string]bool
+}
+
+func parseTextSearch(text string) textSearch {
+	search := textSearch{terms: map[string]bool{}, excluded: map[string]bool{}}
+	for _, field := range strings.Fields(text) {
+		terms := search.terms
+		if strings.HasPrefix(field, "-") {
+			terms = search.excluded
+		}
+		for _, word := range words(field) {
+			terms[word] = true
+		}
+	}
+	return search
+}
+
+// score returns the relevance of a transaction for the search, 0 when it does not match
+func (s textSearch) score(transaction *model.Transaction) float64 {
+	score := 0.0
+	for _, field := range transactionTextFields {
+		for _, word := range words(field.value(transaction)) {
+			if s.excluded[word] {
+				return 0
+			}
+			if s.terms[word] {
+				score += float64(field.weight)
+			}
+		}
+	}
+	return score
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/triplan-planning/api-go/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned by every store when the requested document does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionConflict is returned by Replace when the stored document changed since it was read
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrAlreadyExists is returned when inserting a document whose key is already used
+var ErrAlreadyExists = errors.New("already exists")
+
+// Store gives access to every repository used by the API
+type Store interface {
+	Users() UserStore
+	Groups() GroupStore
+	Transactions() TransactionStore
+	Stats() StatsStore
+	Sessions() SessionStore
+	Invitations() InvitationStore
+	History() HistoryStore
+	IdempotentRequests() IdempotentRequestStore
+	RecurringTransactions() RecurringTransactionStore
+	Webhooks() WebhookStore
+	WebhookDeliveries() WebhookDeliveryStore
+	// WithTransaction runs fn so that either all or none of its changes are applied.
+	// fn must use the given context for every call to the store.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// EnsureIndexes creates the indexes the store relies on, it is called on startup
+	EnsureIndexes(ctx context.Context) error
+}
+
+// Deletion selects documents by their soft deletion state
+type Deletion int
+
+const (
+	// NotDeleted matches documents that are not soft deleted, it is the default
+	NotDeleted Deletion = iota
+	// Deleted matches soft deleted documents, the ones in the trash
+	Deleted
+	// AnyDeletion matches all documents
+	AnyDeletion
+)
+
+// match reports whether a document deleted at deletedAt is selected. With Deleted, a non-zero before also
+// requires the document to have been deleted before that time.
+func (d Deletion) match(deletedAt *time.Time, before time.Time) bool {
+	switch d {
+	case NotDeleted:
+		return deletedAt == nil
+	case Deleted:
+		return deletedAt != nil && (before.IsZero() || deletedAt.Before(before))
+	default:
+		return true
+	}
+}
+
+type UserFilter struct {
+	// Name is a case-insensitive regular expression matched against the user name
+	Name string
+	// Ids limits the result to these users when non-empty
+	Ids []primitive.ObjectID
+	// Page is sorted by SortCreated or SortName
+	Page Page
+}
+
+type UserStore interface {
+	List(ctx context.Context, filter UserFilter) ([]model.User, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.User, error)
+	GetByEmail(ctx context.Context, email string) (model.User, error)
+	// Count returns how many of the given ids belong to existing users
+	Count(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+	// Insert fails with ErrAlreadyExists when another user has the same email
+	Insert(ctx context.Context, user *model.User) error
+	// InsertWithId keeps the id and version of the user, it fails with ErrAlreadyExists when the id or the email is used
+	InsertWithId(ctx context.Context, user *model.User) error
+	// Replace fails with ErrVersionConflict unless the stored version is the one of the given document,
+	// the version of the document is then incremented
+	Replace(ctx context.Context, user *model.User) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type GroupFilter struct {
+	// User limits the result to the groups this user is a member of
+	User primitive.ObjectID
+	// IncludeFormerUsers makes User also match the groups the user left
+	IncludeFormerUsers bool
+	Deletion           Deletion
+	// DeletedBefore limits Deleted to the groups deleted before this time
+	DeletedBefore time.Time
+	// Page is sorted by SortCreated or SortName
+	Page Page
+}
+
+type GroupStore interface {
+	List(ctx context.Context, filter GroupFilter) ([]model.Group, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.Group, error)
+	Insert(ctx context.Context, group *model.Group) error
+	// InsertWithId keeps the id and version of the group, it fails with ErrAlreadyExists when the id is used
+	InsertWithId(ctx context.Context, group *model.Group) error
+	// Replace fails with ErrVersionConflict unless the stored version is the one of the given document,
+	// the version of the document is then incremented
+	Replace(ctx context.Context, group *model.Group) error
+	// AddMember adds a user to the users of a group, doing nothing if the user already is a member
+	AddMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) error
+	// RemoveMember removes a user and its role from a group. With keepAsFormer, the user is added to the former users.
+	RemoveMember(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID, keepAsFormer bool) error
+	// SetDeletedAt moves a group to the trash, or restores it when deletedAt is nil. It fails with
+	// ErrVersionConflict unless the stored version is the given one, which is then incremented.
+	SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type TransactionFilter struct {
+	Group primitive.ObjectID
+	// User limits the result to the transactions paid by or for this user
+	User primitive.ObjectID
+	// Kind limits the result to a kind of transaction, transactions without a kind are expenses
+	Kind     model.TransactionKind
+	Deletion Deletion
+	// DeletedBefore limits Deleted to the transactions deleted before this time
+	DeletedBefore time.Time
+	PaidBy        primitive.ObjectID
+	// Participant limits the result to the transactions paid for this user
+	Participant primitive.ObjectID
+	Category    string
+	// DateFrom and DateTo limit the result to the transactions dated in [DateFrom, DateTo) when non-zero
+	DateFrom time.Time
+	DateTo   time.Time
+	// AmountMin and AmountMax limit the result to the transactions with an amount in [AmountMin, AmountMax] when non-zero
+	AmountMin uint32
+	AmountMax uint32
+	// Recurring limits the result to the transactions created by this recurring transaction
+	Recurring primitive.ObjectID
+	// Page is sorted by SortCreated, SortDate or SortAmount, newest first by default
+	Page Page
+}
+
+type TransactionStore interface {
+	List(ctx context.Context, filter TransactionFilter) ([]model.Transaction, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.Transaction, error)
+	// Search returns at most limit transactions of a group that are not in the trash and have
+	// one of the words of text in their title or category, best matches first
+	Search(ctx context.Context, groupId primitive.ObjectID, text string, limit int) ([]model.TransactionMatch, error)
+	// Stats returns the stats of the transactions of a group that are not in the trash, see model.ComputeGroupStats.
+	// The shares of the participants are the computed prices stored with the transactions when they were saved,
+	// they are not computed again, so that every store returns the same stats.
+	Stats(ctx context.Context, groupId primitive.ObjectID, biggest int) (model.GroupStats, error)
+	Insert(ctx context.Context, transaction *model.Transaction) error
+	// InsertWithId keeps the id and version of the transaction, it fails with ErrAlreadyExists when the id is used
+	InsertWithId(ctx context.Context, transaction *model.Transaction) error
+	// Replace fails with ErrVersionConflict unless the stored version is the one of the given document,
+	// the version of the document is then incremented
+	Replace(ctx context.Context, transaction *model.Transaction) error
+	// SetDeletedAt moves a transaction to the trash, or restores it when deletedAt is nil. It fails with
+	// ErrVersionConflict unless the stored version is the given one, which is then incremented.
+	SetDeletedAt(ctx context.Context, id primitive.ObjectID, version uint32, deletedAt *time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error
+}
+
+type StatsStore interface {
+	// IncrementCalls increments the call counter of the given path and returns its new value
+	IncrementCalls(ctx context.Context, path string) (int64, error)
+}
+
+type SessionStore interface {
+	Get(ctx context.Context, tokenHash string) (model.Session, error)
+	Insert(ctx context.Context, session *model.Session) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteForUser(ctx context.Context, userId primitive.ObjectID) error
+}
+
+type InvitationStore interface {
+	// List returns the invitations of a group, newest first
+	List(ctx context.Context, groupId primitive.ObjectID) ([]model.Invitation, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.Invitation, error)
+	GetByToken(ctx context.Context, tokenHash string) (model.Invitation, error)
+	Insert(ctx context.Context, invitation *model.Invitation) error
+	Replace(ctx context.Context, invitation *model.Invitation) error
+	// Use counts one more use of the invitation if it is usable at the given time, the check and the increment
+	// are atomic. It returns ErrNotFound when the invitation is revoked, expired or has no use left.
+	Use(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error
+}
+
+type HistoryFilter struct {
+	Group    primitive.ObjectID
+	EntityId primitive.ObjectID
+}
+
+// HistoryStore is append-only
+type HistoryStore interface {
+	// List returns the matching entries, newest first
+	List(ctx context.Context, filter HistoryFilter) ([]model.HistoryEntry, error)
+	Insert(ctx context.Context, entry *model.HistoryEntry) error
+}
+
+type IdempotentRequestStore interface {
+	// Get returns the unexpired request with the given key
+	Get(ctx context.Context, key string) (model.IdempotentRequest, error)
+	// Insert fails with ErrAlreadyExists when an unexpired request has the same key
+	Insert(ctx context.Context, request *model.IdempotentRequest) error
+	Replace(ctx context.Context, request *model.IdempotentRequest) error
+	Delete(ctx context.Context, key string) error
+	// DeleteExpired deletes the requests expired at the given time
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+type RecurringTransactionStore interface {
+	// List returns the recurring transactions of a group, oldest first
+	List(ctx context.Context, groupId primitive.ObjectID) ([]model.RecurringTransaction, error)
+	// ListDue returns the recurring transactions whose next occurrence is at or before the given time
+	ListDue(ctx context.Context, now time.Time) ([]model.RecurringTransaction, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.RecurringTransaction, error)
+	Insert(ctx context.Context, recurring *model.RecurringTransaction) error
+	// Replace fails with ErrVersionConflict unless the stored version is the one of the given document,
+	// the version of the document is then incremented
+	Replace(ctx context.Context, recurring *model.RecurringTransaction) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error
+}
+
+type WebhookStore interface {
+	// List returns the webhooks of a group, oldest first
+	List(ctx context.Context, groupId primitive.ObjectID) ([]model.Webhook, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.Webhook, error)
+	Insert(ctx context.Context, webhook *model.Webhook) error
+	// Replace fails with ErrVersionConflict unless the stored version is the one of the given document,
+	// the version of the document is then incremented
+	Replace(ctx context.Context, webhook *model.Webhook) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error
+}
+
+type WebhookDeliveryStore interface {
+	// List returns at most limit deliveries of a webhook, newest first
+	List(ctx context.Context, webhookId primitive.ObjectID, limit int) ([]model.WebhookDelivery, error)
+	// ListDue returns the deliveries whose next attempt is at or before the given time, oldest first
+	ListDue(ctx context.Context, now time.Time) ([]model.WebhookDelivery, error)
+	Get(ctx context.Context, id primitive.ObjectID) (model.WebhookDelivery, error)
+	Insert(ctx context.Context, delivery *model.WebhookDelivery) error
+	Replace(ctx context.Context, delivery *model.WebhookDelivery) error
+	DeleteForWebhook(ctx context.Context, webhookId primitive.ObjectID) error
+	DeleteForGroup(ctx context.Context, groupId primitive.ObjectID) error
+	// DeleteFinished deletes the deliveries created before the given time that have no attempt left
+	DeleteFinished(ctx context.Context, before time.Time) error
+}